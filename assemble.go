@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// Сколько вопросов выдавать в одной попытке по умолчанию (0 — весь банк)
+var questionsPerTest int
+
+// sampleQuestions выбирает n случайных вопросов из qs, сохраняя порядок банка.
+// При n <= 0 или n >= len(qs) возвращается весь банк.
+func sampleQuestions(qs []Question, n int) []Question {
+	if n <= 0 || n >= len(qs) {
+		return qs
+	}
+	idx := rand.Perm(len(qs))[:n]
+	sort.Ints(idx)
+
+	out := make([]Question, n)
+	for i, j := range idx {
+		out[i] = qs[j]
+	}
+	return out
+}
+
+// shuffleQuestions возвращает вопросы в случайном порядке (исходный срез не меняется)
+func shuffleQuestions(qs []Question) []Question {
+	out := make([]Question, len(qs))
+	copy(out, qs)
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// shuffleOptions возвращает порядок показа вариантов: order[i] — индекс
+// варианта в банке, стоящего на позиции i. Закреплённые варианты (Pinned,
+// например "impossible" или "All of the above") остаются на своих местах.
+// У ordering ключ — порядок банка, поэтому его самого не показываем.
+func shuffleOptions(q Question) []int {
+	pinned := make(map[int]bool, len(q.Pinned))
+	for _, p := range q.Pinned {
+		pinned[p] = true
+	}
+
+	var free []int // позиции, которые можно перемешивать
+	for i := range q.Options {
+		if !pinned[i] {
+			free = append(free, i)
+		}
+	}
+	perm := rand.Perm(len(free))
+	for q.Kind() == TypeOrdering && len(free) >= 2 && slices.IsSorted(perm) {
+		perm = rand.Perm(len(free))
+	}
+
+	order := make([]int, len(q.Options))
+	for i := range order {
+		order[i] = i
+	}
+	for k, pos := range free {
+		order[pos] = free[perm[k]]
+	}
+	return order
+}
+
+// permuteStrings раскладывает варианты в порядке показа
+func permuteStrings(items []string, order []int) []string {
+	out := make([]string, len(order))
+	for i, j := range order {
+		out[i] = items[j]
+	}
+	return out
+}
+
+// filterByTags оставляет вопросы, у которых есть хотя бы одна из тем tags.
+// Пустой tags — без фильтра.
+func filterByTags(qs []Question, tags []string) []Question {
+	if len(tags) == 0 {
+		return qs
+	}
+	var out []Question
+	for _, q := range qs {
+		if q.HasAnyTag(tags) {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// countTags — сколько вопросов банка в каждой теме
+func countTags(qs []Question) map[string]int {
+	counts := make(map[string]int)
+	for _, q := range qs {
+		for _, t := range q.Tags {
+			counts[t]++
+		}
+	}
+	return counts
+}
+
+// Экзамен, который берётся, если клиент не указал свой
+const defaultExamID = "default"
+
+// findExam ищет экзамен по id. Без id берётся "default", а если его нет —
+// пустой экзамен со случайной выборкой.
+func findExam(bank *Bank, id string) (*Exam, error) {
+	if id == "" {
+		if exam, ok := bank.Exams[defaultExamID]; ok {
+			return exam, nil
+		}
+		return &Exam{}, nil
+	}
+	exam, ok := bank.Exams[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown exam %q", id)
+	}
+	return exam, nil
+}
+
+// selectQuestions выбирает вопросы новой попытки: по blueprint экзамена,
+// если он задан, иначе — случайные questionsPerTest вопросов из запрошенных тем.
+// Размер попытки клиент не выбирает: иначе можно попросить один лёгкий
+// вопрос и сдать по проценту.
+func selectQuestions(bank *Bank, exam *Exam, req StartRequest) ([]Question, error) {
+	if exam.Blueprint != nil {
+		if len(req.Categories) > 0 {
+			return nil, errors.New("categories cannot be combined with an exam blueprint")
+		}
+		return exam.Sample(), nil
+	}
+
+	pool := filterByTags(bank.Questions, req.Categories)
+	if len(pool) == 0 {
+		return nil, errors.New("no questions in the requested categories")
+	}
+	if len(req.Categories) > 0 && len(pool) < questionsPerTest {
+		return nil, fmt.Errorf("only %d questions in the requested categories, an attempt needs %d",
+			len(pool), questionsPerTest)
+	}
+	return sampleQuestions(pool, questionsPerTest), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShuffleOptionsOrderingNeverShowsKey(t *testing.T) {
+	for _, n := range []int{2, 3, 5} {
+		q := Question{Type: TypeOrdering, Options: make([]string, n)}
+		for range 500 {
+			order := shuffleOptions(q)
+			if slices.IsSorted(order) {
+				t.Fatalf("%d items: shown in key order %v", n, order)
+			}
+			sorted := slices.Clone(order)
+			slices.Sort(sorted)
+			for i, v := range sorted {
+				if v != i {
+					t.Fatalf("%d items: %v is not a permutation", n, order)
+				}
+			}
+		}
+	}
+}
+
+func TestShuffleOptionsSingleKeepsIdentityPossible(t *testing.T) {
+	// Для single порядок банка ничего не выдаёт и должен выпадать как обычно
+	q := Question{Options: []string{"a", "b"}}
+	seen := false
+	for range 200 {
+		if slices.IsSorted(shuffleOptions(q)) {
+			seen = true
+			break
+		}
+	}
+	if !seen {
+		t.Error("single question never kept bank order in 200 shuffles")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Промежуточное сохранение ответов
+type SaveRequest struct {
+	TestID  string   `json:"test_id"`
+	User    string   `json:"user"`
+	Answers []Answer `json:"answers"` // можно присылать не все вопросы: остальные не меняются
+}
+
+// Попытка в том виде, в каком её восстанавливает фронт после перезагрузки
+type AttemptResponse struct {
+	Success   bool             `json:"success"`
+	TestID    string           `json:"test_id"`
+	State     string           `json:"state"`
+	Questions []PublicQuestion `json:"test"`
+	Saved     []Answer         `json:"saved"`
+	Deadline  *time.Time       `json:"deadline,omitempty"`
+}
+
+// mergeAnswers накладывает ответы next на saved: ответ на тот же вопрос
+// заменяется, новые дописываются в конец
+func mergeAnswers(saved, next []Answer) []Answer {
+	out := make([]Answer, 0, len(saved)+len(next))
+	pos := make(map[int]int, len(saved)+len(next)) // question_id -> индекс в out
+	for _, list := range [][]Answer{saved, next} {
+		for _, a := range list {
+			if i, ok := pos[a.QuestionID]; ok {
+				out[i] = a
+				continue
+			}
+			pos[a.QuestionID] = len(out)
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// POST /save — сохранить ответы, не сдавая попытку
+func saveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
+	}
+
+	var req SaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"error":   "invalid json",
+		})
+		return
+	}
+
+	attempt, err := findAttempt(req.TestID)
+	if err == nil {
+		err = attempt.checkUser(req.User)
+	}
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	if err := attempt.checkOpen(time.Now()); err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	if problems := validateAnswers(attempt.questionsByID(), req.Answers); len(problems) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success":  false,
+			"error":    "invalid answers",
+			"problems": problems,
+		})
+		return
+	}
+
+	saved, err := store.Save(req.TestID, req.Answers)
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"state":   AttemptInProgress,
+		"saved":   saved,
+	})
+}
+
+// GET /attempt/{test_id}?user=... — вопросы попытки в том же порядке
+// и сохранённые ответы, чтобы продолжить после перезагрузки страницы
+func attemptHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
+	}
+
+	testID := r.PathValue("test_id")
+	attempt, err := findAttempt(testID)
+	if err == nil {
+		err = attempt.checkUser(r.URL.Query().Get("user"))
+	}
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	saved := attempt.Saved
+	if saved == nil {
+		saved = []Answer{}
+	}
+	writeJSON(w, http.StatusOK, AttemptResponse{
+		Success:   true,
+		TestID:    testID,
+		State:     attempt.State,
+		Questions: publicQuestions(attempt),
+		Saved:     saved,
+		Deadline:  attempt.Deadline,
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Формат файла банка (одинаковый для JSON и YAML)
+type bankFile struct {
+	Questions []Question    `json:"questions"`
+	Media     []*MediaAsset `json:"media"`
+}
+
+// Загруженный банк вопросов. После загрузки не меняется:
+// перезагрузка создаёт новый Bank и подменяет указатель целиком.
+type Bank struct {
+	Questions []Question
+	Files     []string // файлы, из которых собран банк
+	Version   string   // хэш содержимого файлов (включая вложения)
+	Media     map[string]*MediaAsset
+	Exams     map[string]*Exam // экзамены, проверенные на этом банке
+
+	sources []string // файл каждого вопроса (по тому же индексу)
+}
+
+// Текущий банк вопросов
+var currentBank atomic.Pointer[Bank]
+
+// reloadBank загружает банк из dir и экзамены из examsDir и атомарно делает
+// их текущими. Если банк не проходит проверку или не может обеспечить какой-то
+// экзамен, текущий банк остаётся прежним.
+func reloadBank(dir, examsDir string) (*Bank, error) {
+	bank, err := LoadBank(dir)
+	if err != nil {
+		return nil, err
+	}
+	if bank.Exams, err = LoadExams(examsDir, bank); err != nil {
+		return nil, err
+	}
+	archiveMedia(bank)
+	currentBank.Store(bank)
+	log.Printf("Loaded %d questions from %d bank files (version %s), %d exams",
+		len(bank.Questions), len(bank.Files), bank.Version, len(bank.Exams))
+	for id, exam := range bank.Exams {
+		if exam.Blueprint != nil {
+			log.Printf("Exam %q: %d questions, %s distinct forms", id, exam.Size(), exam.Forms())
+		}
+	}
+	return bank, nil
+}
+
+// watchSIGHUP перечитывает банк и экзамены по сигналу SIGHUP
+func watchSIGHUP(dir, examsDir string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if _, err := reloadBank(dir, examsDir); err != nil {
+				log.Printf("bank reload failed, keeping version %s: %v", currentBank.Load().Version, err)
+			}
+		}
+	}()
+}
+
+// Ошибка загрузки банка со списком всех найденных проблем
+type BankError struct {
+	Problems []string
+}
+
+func (e *BankError) Error() string {
+	return fmt.Sprintf("question bank is invalid (%d problems):\n  %s",
+		len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+func (e *BankError) add(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// LoadBank читает все *.json, *.yaml и *.yml из каталога dir (по алфавиту)
+// и собирает из них один банк. Если хоть один файл некорректен,
+// возвращается *BankError со всеми проблемами сразу.
+func LoadBank(dir string) (*Bank, error) {
+	bank, berr, err := readBankDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(berr.Problems) > 0 {
+		return nil, berr
+	}
+	return bank, nil
+}
+
+// readBankDir разбирает каталог банка и возвращает всё, что удалось прочитать,
+// вместе со списком проблем. err — только если сам каталог недоступен.
+func readBankDir(dir string) (*Bank, *BankError, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read bank dir: %w", err)
+	}
+
+	bank := &Bank{Media: make(map[string]*MediaAsset)}
+	berr := &BankError{}
+	h := sha256.New()
+	seen := make(map[int]string) // id -> файл, где он впервые встретился
+
+	for _, e := range entries {
+		if e.IsDir() || !isBankFile(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		bank.Files = append(bank.Files, path)
+
+		f, err := readBankFile(path, h)
+		if err != nil {
+			berr.add("%s: %v", path, err)
+			continue
+		}
+		if len(f.Questions) == 0 && len(f.Media) == 0 {
+			berr.add("%s: no questions", path)
+			continue
+		}
+		for _, m := range f.Media {
+			if err := loadMediaAsset(dir, m, h); err != nil {
+				berr.add("%s: %v", path, err)
+				continue
+			}
+			if _, dup := bank.Media[m.ID]; dup {
+				berr.add("%s: media id %q already used", path, m.ID)
+				continue
+			}
+			bank.Media[m.ID] = m
+		}
+		for i, q := range f.Questions {
+			where := fmt.Sprintf("%s: question #%d (id %d)", path, i+1, q.ID)
+			for _, p := range checkQuestion(q) {
+				berr.add("%s: %s", where, p)
+			}
+			if prev, dup := seen[q.ID]; dup {
+				berr.add("%s: id already used in %s", where, prev)
+			} else if q.ID > 0 {
+				seen[q.ID] = path
+			}
+		}
+		bank.Questions = append(bank.Questions, f.Questions...)
+		for range f.Questions {
+			bank.sources = append(bank.sources, path)
+		}
+	}
+
+	if len(bank.Files) == 0 {
+		berr.add("%s: no bank files (*.json, *.yaml, *.yml)", dir)
+	}
+	// Вложения могут лежать в другом файле банка, поэтому ссылки
+	// проверяем, когда прочитаны все файлы
+	for i, q := range bank.Questions {
+		for _, id := range q.Media {
+			if _, ok := bank.Media[id]; !ok {
+				berr.add("%s: id %d: unknown media %q", bank.sources[i], q.ID, id)
+			}
+		}
+		if q.Image != "" {
+			for _, p := range checkHotspotImage(q, bank.Media[q.Image]) {
+				berr.add("%s: id %d: %s", bank.sources[i], q.ID, p)
+			}
+		}
+	}
+	bank.Version = hex.EncodeToString(h.Sum(nil))[:12]
+	return bank, berr, nil
+}
+
+func isBankFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func readBankFile(path string, h io.Writer) (*bankFile, error) {
+	var f bankFile
+	if err := readConfigFile(path, h, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// readConfigFile разбирает один файл банка или экзамена в v. YAML сначала
+// переводится в JSON, чтобы у обоих форматов была одна схема (json-теги)
+// и одинаково строгая проверка неизвестных полей. Сырое содержимое
+// дописывается в h.
+func readConfigFile(path string, h io.Writer, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "%s\x00", filepath.Base(path))
+	h.Write(data)
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var y any
+		if err := yaml.Unmarshal(data, &y); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(y); err != nil {
+			return err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// checkQuestion — структурные проверки, без которых вопрос нельзя выдать.
+// Содержательные замечания (нерешённые ключи, дубли) — в команде validate.
+func checkQuestion(q Question) []string {
+	var problems []string
+	if q.ID <= 0 {
+		problems = append(problems, "id must be positive")
+	}
+	if strings.TrimSpace(q.Question) == "" {
+		problems = append(problems, "empty question text")
+	}
+	if q.HasOptions() && len(q.Options) < 2 {
+		problems = append(problems, "at least 2 options required")
+	}
+	if !q.HasOptions() && len(q.Options) > 0 {
+		problems = append(problems, fmt.Sprintf("options are not used by %s questions", q.Kind()))
+	}
+	problems = append(problems, checkKey(q)...)
+	problems = append(problems, checkScores(q)...)
+	for i, l := range q.Links {
+		if strings.TrimSpace(l.Title) == "" {
+			problems = append(problems, fmt.Sprintf("link #%d: empty title", i+1))
+		}
+		if u, err := url.Parse(l.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("link #%d: %q is not an http(s) URL", i+1, l.URL))
+		}
+	}
+	for _, p := range q.Pinned {
+		if p < 0 || p >= len(q.Options) {
+			problems = append(problems, fmt.Sprintf("pinned option %d out of range [0, %d)", p, len(q.Options)))
+		}
+	}
+	return problems
+}
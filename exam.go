@@ -0,0 +1,543 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Экзамен: как собирать попытку из банка
+type Exam struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title,omitempty"`
+	Blueprint *Blueprint `json:"blueprint,omitempty"`
+
+	Review   string     `json:"review,omitempty"`    // политика разбора: score, wrong, full, after_close
+	ClosesAt *time.Time `json:"closes_at,omitempty"` // конец окна экзамена: новые попытки не выдаются
+
+	PassPercent *float64    `json:"pass_percent,omitempty"` // порог сдачи в процентах (по умолчанию 60)
+	Grades      []GradeBand `json:"grades,omitempty"`       // шкала оценок, например 5/4/3/2
+
+	Scoring string  `json:"scoring,omitempty"` // политика баллов: standard (по умолчанию), negative
+	Penalty float64 `json:"penalty,omitempty"` // negative: штраф за ошибку, доля баллов вопроса
+
+	// Лимит времени на попытку ("45m"); после дедлайна и grace сдача
+	// отклоняется (reject) или проверяются сохранённые ответы (autograde)
+	Duration  Duration `json:"duration,omitempty"`
+	Grace     Duration `json:"grace,omitempty"`
+	OnTimeout string   `json:"on_timeout,omitempty"`
+}
+
+// Что делать со сдачей после дедлайна
+const (
+	TimeoutReject    = "reject"    // по умолчанию
+	TimeoutAutograde = "autograde" // проверить сохранённые ответы; если их нет — как reject
+)
+
+// Duration в файлах экзамена записывается строкой: "45m", "1h30m"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"45m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// checkTiming проверяет лимит времени экзамена
+func (e *Exam) checkTiming() []string {
+	var problems []string
+	if e.Duration.Duration < 0 || e.Grace.Duration < 0 {
+		problems = append(problems, "duration and grace must not be negative")
+	}
+	switch e.OnTimeout {
+	case "", TimeoutReject, TimeoutAutograde:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown on_timeout %q", e.OnTimeout))
+	}
+	return problems
+}
+
+// deadline — до какого момента надо сдать попытку, начатую в start:
+// по лимиту времени, но не позже закрытия экзамена (nil — без ограничений)
+func (e *Exam) deadline(start time.Time) *time.Time {
+	var d *time.Time
+	if e.Duration.Duration > 0 {
+		t := start.Add(e.Duration.Duration)
+		d = &t
+	}
+	if e.ClosesAt != nil && (d == nil || e.ClosesAt.Before(*d)) {
+		t := *e.ClosesAt
+		d = &t
+	}
+	return d
+}
+
+// Оценка, которую получает результат не ниже Min процентов
+type GradeBand struct {
+	Name string  `json:"name"`
+	Min  float64 `json:"min"`
+}
+
+// Порог сдачи, если экзамен не задаёт свой
+const defaultPassPercent = 60.0
+
+// Blueprint — правила состава попытки: "5 из networking, 3 из virtualization,
+// 2 из printers, хотя бы один вопрос с картинкой".
+//
+// Правила разбирают банк по порядку: вопрос относится к первому правилу,
+// под фильтр которого подходит, поэтому пулы правил не пересекаются.
+// Вопросы без ключа в пулы не попадают: count — это вопросы, которые пойдут в зачёт.
+// Ограничения проверяются на уже собранной попытке.
+type Blueprint struct {
+	Rules       []BlueprintRule       `json:"rules"`
+	Constraints []BlueprintConstraint `json:"constraints,omitempty"`
+
+	plan *blueprintPlan // пулы и таблица подсчёта для текущего банка
+}
+
+type BlueprintRule struct {
+	QuestionFilter
+	Count int `json:"count"`
+}
+
+type BlueprintConstraint struct {
+	QuestionFilter
+	Min int `json:"min"`
+}
+
+// Фильтр вопросов; пустой фильтр подходит под любой вопрос
+type QuestionFilter struct {
+	Tags  []string `json:"tags,omitempty"`  // хотя бы одна из тем
+	Media bool     `json:"media,omitempty"` // только вопросы с вложениями
+	Text  string   `json:"text,omitempty"`  // регулярное выражение по тексту вопроса
+
+	re *regexp.Regexp
+}
+
+func (f *QuestionFilter) compile() error {
+	if f.Text == "" {
+		return nil
+	}
+	re, err := regexp.Compile(f.Text)
+	if err != nil {
+		return err
+	}
+	f.re = re
+	return nil
+}
+
+func (f *QuestionFilter) match(q Question) bool {
+	if len(f.Tags) > 0 && !q.HasAnyTag(f.Tags) {
+		return false
+	}
+	if f.Media && !q.HasMedia() {
+		return false
+	}
+	if f.re != nil && !f.re.MatchString(q.Question) {
+		return false
+	}
+	return true
+}
+
+func (f *QuestionFilter) String() string {
+	var parts []string
+	if len(f.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(f.Tags, ","))
+	}
+	if f.Media {
+		parts = append(parts, "with media")
+	}
+	if f.Text != "" {
+		parts = append(parts, fmt.Sprintf("text /%s/", f.Text))
+	}
+	if len(parts) == 0 {
+		return "any question"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// LoadExams читает описания экзаменов из dir и проверяет, что банк может
+// собрать каждое из них. Отсутствующий каталог — просто нет экзаменов.
+func LoadExams(dir string, bank *Bank) (map[string]*Exam, error) {
+	exams := make(map[string]*Exam)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return exams, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read exams dir: %w", err)
+	}
+
+	berr := &BankError{}
+	for _, e := range entries {
+		if e.IsDir() || !isBankFile(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+
+		var exam Exam
+		if err := readConfigFile(path, io.Discard, &exam); err != nil {
+			berr.add("%s: %v", path, err)
+			continue
+		}
+		if exam.ID == "" {
+			exam.ID = strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		}
+		if _, dup := exams[exam.ID]; dup {
+			berr.add("%s: exam id %q already used", path, exam.ID)
+			continue
+		}
+		problems := exam.prepare(bank)
+		for _, p := range problems {
+			berr.add("%s: exam %q: %s", path, exam.ID, p)
+		}
+		if len(problems) == 0 {
+			exams[exam.ID] = &exam
+		}
+	}
+	if len(berr.Problems) > 0 {
+		return nil, berr
+	}
+	return exams, nil
+}
+
+// prepare проверяет описание экзамена и строит план сборки по банку
+func (e *Exam) prepare(bank *Bank) []string {
+	problems := e.checkReviewPolicy()
+	problems = append(problems, e.checkGrades()...)
+	problems = append(problems, e.checkScoring()...)
+	problems = append(problems, e.checkTiming()...)
+	b := e.Blueprint
+	if b == nil {
+		return problems
+	}
+
+	if len(b.Rules) == 0 {
+		problems = append(problems, "blueprint has no rules")
+	}
+	for i := range b.Rules {
+		r := &b.Rules[i]
+		if r.Count <= 0 {
+			problems = append(problems, fmt.Sprintf("rule #%d: count must be positive", i+1))
+		}
+		if err := r.compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("rule #%d: %v", i+1, err))
+		}
+	}
+	for i := range b.Constraints {
+		c := &b.Constraints[i]
+		if c.Min <= 0 {
+			problems = append(problems, fmt.Sprintf("constraint #%d: min must be positive", i+1))
+		}
+		if err := c.compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("constraint #%d: %v", i+1, err))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	b.plan = newBlueprintPlan(b, bank.Questions)
+	for i, r := range b.Rules {
+		if have := b.plan.poolSize(i); have < r.Count {
+			problems = append(problems, fmt.Sprintf("rule #%d (%s) needs %d questions, bank has %d with an answer key",
+				i+1, r.String(), r.Count, have))
+		}
+	}
+	if len(problems) == 0 && b.plan.Forms().Sign() == 0 {
+		problems = append(problems, "constraints cannot be satisfied by any combination of questions")
+	}
+	return problems
+}
+
+// checkGrades проверяет порог сдачи и шкалу оценок и сортирует шкалу
+// от высшей оценки к низшей
+func (e *Exam) checkGrades() []string {
+	var problems []string
+	if p := e.PassPercent; p != nil && (*p < 0 || *p > 100) {
+		problems = append(problems, fmt.Sprintf("pass_percent %g out of range [0, 100]", *p))
+	}
+	if len(e.Grades) == 0 {
+		return problems
+	}
+	seen := make(map[string]bool, len(e.Grades))
+	hasZero := false
+	for i, g := range e.Grades {
+		if strings.TrimSpace(g.Name) == "" {
+			problems = append(problems, fmt.Sprintf("grade #%d: empty name", i+1))
+		} else if seen[g.Name] {
+			problems = append(problems, fmt.Sprintf("grade #%d: name %q repeated", i+1, g.Name))
+		}
+		seen[g.Name] = true
+		if g.Min < 0 || g.Min > 100 {
+			problems = append(problems, fmt.Sprintf("grade #%d: min %g out of range [0, 100]", i+1, g.Min))
+		}
+		hasZero = hasZero || g.Min == 0
+	}
+	if !hasZero {
+		problems = append(problems, "grades: the lowest grade must have min 0")
+	}
+	slices.SortStableFunc(e.Grades, func(a, b GradeBand) int { return cmp.Compare(b.Min, a.Min) })
+	return problems
+}
+
+// Grade переводит балл в процент, оценку по шкале экзамена и зачёт.
+// Со штрафами балл бывает отрицательным, но процент не опускается ниже 0 —
+// иначе не найдётся оценка даже у нижней полосы (min 0).
+func (e *Exam) Grade(score, total float64) (percent float64, grade string, passed bool) {
+	if total > 0 {
+		percent = max(score/total*100, 0)
+	}
+	for _, g := range e.Grades {
+		if percent >= g.Min {
+			grade = g.Name
+			break
+		}
+	}
+	pass := defaultPassPercent
+	if e.PassPercent != nil {
+		pass = *e.PassPercent
+	}
+	return percent, grade, percent >= pass
+}
+
+// Size — сколько вопросов в попытке по этому экзамену (0 — без blueprint)
+func (e *Exam) Size() int {
+	if e.Blueprint == nil {
+		return 0
+	}
+	n := 0
+	for _, r := range e.Blueprint.Rules {
+		n += r.Count
+	}
+	return n
+}
+
+// Forms — число различных наборов вопросов, которые может дать экзамен
+func (e *Exam) Forms() *big.Int {
+	if e.Blueprint == nil || e.Blueprint.plan == nil {
+		return new(big.Int)
+	}
+	return e.Blueprint.plan.Forms()
+}
+
+// Sample собирает случайный набор вопросов по blueprint.
+// Все допустимые наборы равновероятны.
+func (e *Exam) Sample() []Question {
+	return e.Blueprint.plan.sample()
+}
+
+// blueprintPlan считает и выбирает наборы вопросов динамикой по правилам.
+//
+// Каждый вопрос пула получает маску — каким ограничениям он удовлетворяет.
+// Состояние динамики — сколько вопросов уже набрано под каждое ограничение
+// (с отсечкой на Min). suffix[i][s] — число способов добрать правила i..n-1
+// из состояния s так, чтобы все ограничения выполнились.
+type blueprintPlan struct {
+	rules  []planRule
+	caps   []int // Min каждого ограничения
+	suffix [][]*big.Int
+}
+
+type planRule struct {
+	groups  [][]Question // вопросы пула, сгруппированные по маске
+	masks   []int
+	choices []planChoice // все способы разложить Count по группам
+}
+
+type planChoice struct {
+	take []int    // сколько вопросов взять из каждой группы
+	ways *big.Int // произведение биномиальных коэффициентов
+	add  []int    // сколько добавится к каждому ограничению
+}
+
+func newBlueprintPlan(b *Blueprint, qs []Question) *blueprintPlan {
+	p := &blueprintPlan{}
+	for _, c := range b.Constraints {
+		p.caps = append(p.caps, c.Min)
+	}
+
+	used := make([]bool, len(qs))
+	for _, r := range b.Rules {
+		byMask := make(map[int]int) // маска -> индекс группы
+		var pr planRule
+		for i, q := range qs {
+			if used[i] || q.Unscored() || !r.match(q) {
+				continue
+			}
+			used[i] = true
+			mask := 0
+			for c := range b.Constraints {
+				if b.Constraints[c].match(q) {
+					mask |= 1 << c
+				}
+			}
+			g, ok := byMask[mask]
+			if !ok {
+				g = len(pr.groups)
+				byMask[mask] = g
+				pr.groups = append(pr.groups, nil)
+				pr.masks = append(pr.masks, mask)
+			}
+			pr.groups[g] = append(pr.groups[g], q)
+		}
+		pr.choices = p.choices(pr, r.Count)
+		p.rules = append(p.rules, pr)
+	}
+
+	// Динамика с конца: из финального состояния "все ограничения выполнены"
+	states := p.states()
+	p.suffix = make([][]*big.Int, len(p.rules)+1)
+	p.suffix[len(p.rules)] = make([]*big.Int, states)
+	for s := range states {
+		p.suffix[len(p.rules)][s] = new(big.Int)
+	}
+	p.suffix[len(p.rules)][states-1].SetInt64(1)
+	for i := len(p.rules) - 1; i >= 0; i-- {
+		p.suffix[i] = make([]*big.Int, states)
+		for s := range states {
+			sum := new(big.Int)
+			for _, ch := range p.rules[i].choices {
+				next := p.suffix[i+1][p.advance(s, ch.add)]
+				sum.Add(sum, new(big.Int).Mul(ch.ways, next))
+			}
+			p.suffix[i][s] = sum
+		}
+	}
+	return p
+}
+
+func (p *blueprintPlan) poolSize(rule int) int {
+	n := 0
+	for _, g := range p.rules[rule].groups {
+		n += len(g)
+	}
+	return n
+}
+
+func (p *blueprintPlan) Forms() *big.Int {
+	return new(big.Int).Set(p.suffix[0][0])
+}
+
+// states — число состояний: произведение (Min+1) по ограничениям.
+// Последнее состояние — все ограничения набраны.
+func (p *blueprintPlan) states() int {
+	n := 1
+	for _, c := range p.caps {
+		n *= c + 1
+	}
+	return n
+}
+
+// advance добавляет к состоянию s вклад выбора (смешанная система счисления)
+func (p *blueprintPlan) advance(s int, add []int) int {
+	next, mul := 0, 1
+	for c, limit := range p.caps {
+		v := s % (limit + 1)
+		s /= limit + 1
+		next += min(v+add[c], limit) * mul
+		mul *= limit + 1
+	}
+	return next
+}
+
+// choices перечисляет все разложения count по группам правила
+func (p *blueprintPlan) choices(pr planRule, count int) []planChoice {
+	var out []planChoice
+	take := make([]int, len(pr.groups))
+	var rec func(g, left int)
+	rec = func(g, left int) {
+		if g == len(pr.groups) {
+			if left > 0 {
+				return
+			}
+			ch := planChoice{
+				take: append([]int(nil), take...),
+				ways: big.NewInt(1),
+				add:  make([]int, len(p.caps)),
+			}
+			for i, k := range take {
+				ch.ways.Mul(ch.ways, new(big.Int).Binomial(int64(len(pr.groups[i])), int64(k)))
+				for c := range p.caps {
+					if pr.masks[i]&(1<<c) != 0 {
+						ch.add[c] += k
+					}
+				}
+			}
+			out = append(out, ch)
+			return
+		}
+		for k := 0; k <= min(left, len(pr.groups[g])); k++ {
+			take[g] = k
+			rec(g+1, left-k)
+		}
+		take[g] = 0
+	}
+	rec(0, count)
+	return out
+}
+
+// sample выбирает разложение для каждого правила с вероятностью,
+// пропорциональной числу наборов, которые через него проходят
+func (p *blueprintPlan) sample() []Question {
+	var out []Question
+	s := 0
+	for i, pr := range p.rules {
+		r := randBig(p.suffix[i][s])
+		for _, ch := range pr.choices {
+			next := p.advance(s, ch.add)
+			w := new(big.Int).Mul(ch.ways, p.suffix[i+1][next])
+			if r.Cmp(w) >= 0 {
+				r.Sub(r, w)
+				continue
+			}
+			for g, k := range ch.take {
+				for _, j := range rand.Perm(len(pr.groups[g]))[:k] {
+					out = append(out, pr.groups[g][j])
+				}
+			}
+			s = next
+			break
+		}
+	}
+	return out
+}
+
+// randBig — равномерное случайное число в [0, n)
+func randBig(n *big.Int) *big.Int {
+	bits := n.BitLen()
+	buf := make([]byte, (bits+7)/8)
+	r := new(big.Int)
+	for {
+		rand.Read(buf)
+		if extra := len(buf)*8 - bits; extra > 0 {
+			buf[0] &= byte(0xff >> extra)
+		}
+		if r.SetBytes(buf).Cmp(n) < 0 {
+			return r
+		}
+	}
+}
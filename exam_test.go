@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Банк для тестов blueprint: темы a и b, у части вопросов в тексте "picture"
+func blueprintBank() *Bank {
+	key := 0
+	q := func(id int, text string, tags ...string) Question {
+		return Question{ID: id, Question: text, Tags: tags, Options: []string{"x", "y"}, Answer: &key}
+	}
+	unresolved := -1
+	return &Bank{Questions: []Question{
+		q(1, "a1 picture", "a"),
+		q(2, "a2", "a"),
+		q(3, "a3", "a"),
+		q(4, "a4", "a"),
+		q(5, "b1 picture", "b"),
+		q(6, "b2", "b"),
+		q(7, "b3", "b"),
+		q(8, "ab", "a", "b"), // попадает только в первое подходящее правило
+		// Без ключа: в пулы не попадает, иначе съел бы место в попытке
+		{ID: 9, Question: "a9 picture", Tags: []string{"a"}, Options: []string{"x", "y"}, Answer: &unresolved},
+	}}
+}
+
+func rule(count int, tags ...string) BlueprintRule {
+	return BlueprintRule{QuestionFilter: QuestionFilter{Tags: tags}, Count: count}
+}
+
+func pictures(min int) BlueprintConstraint {
+	return BlueprintConstraint{QuestionFilter: QuestionFilter{Text: "picture"}, Min: min}
+}
+
+func TestBlueprintForms(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []BlueprintRule
+		constraints []BlueprintConstraint
+		forms       int64
+		problem     string // подстрока ожидаемой проблемы prepare
+	}{
+		{
+			name:  "one rule, no constraints",
+			rules: []BlueprintRule{rule(2, "a")}, // C(5,2)
+			forms: 10,
+		},
+		{
+			name:  "overlapping tags go to the first rule",
+			rules: []BlueprintRule{rule(1, "a"), rule(1, "b")}, // 5 * 3
+			forms: 15,
+		},
+		{
+			name:        "constraint across rules",
+			rules:       []BlueprintRule{rule(1, "a"), rule(1, "b")},
+			constraints: []BlueprintConstraint{pictures(1)}, // 15 минус 4*2 без картинок
+			forms:       7,
+		},
+		{
+			name:        "constraint needs both pictures",
+			rules:       []BlueprintRule{rule(2, "a"), rule(1, "b")},
+			constraints: []BlueprintConstraint{pictures(2)}, // a1 + любой из 4 в a, b1
+			forms:       4,
+		},
+		{
+			name:        "constraint cannot be met",
+			rules:       []BlueprintRule{rule(2, "a"), rule(1, "b")},
+			constraints: []BlueprintConstraint{pictures(3)},
+			forms:       0,
+			problem:     "constraints cannot be satisfied",
+		},
+		{
+			name:    "pool too small",
+			rules:   []BlueprintRule{rule(5, "b")},
+			forms:   0,
+			problem: "rule #1 (tags b) needs 5 questions, bank has 4 with an answer key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Exam{ID: "t", Blueprint: &Blueprint{Rules: tt.rules, Constraints: tt.constraints}}
+			problems := e.prepare(blueprintBank())
+			if got := e.Forms().Int64(); got != tt.forms {
+				t.Errorf("Forms() = %d, want %d", got, tt.forms)
+			}
+			joined := strings.Join(problems, "; ")
+			if tt.problem == "" && len(problems) > 0 {
+				t.Errorf("unexpected problems: %s", joined)
+			}
+			if tt.problem != "" && !strings.Contains(joined, tt.problem) {
+				t.Errorf("problems %q do not mention %q", joined, tt.problem)
+			}
+		})
+	}
+}
+
+func TestBlueprintPlanAdvance(t *testing.T) {
+	// Два ограничения с Min 2 и 1: состояние = v0 + 3*v1
+	p := &blueprintPlan{caps: []int{2, 1}}
+	tests := []struct {
+		s    int
+		add  []int
+		want int
+	}{
+		{0, []int{0, 0}, 0},
+		{0, []int{1, 0}, 1},
+		{0, []int{0, 1}, 3},
+		{1, []int{1, 1}, 5},
+		{2, []int{3, 0}, 2}, // набранное сверх Min не считается
+		{5, []int{1, 1}, 5}, // финальное состояние не меняется
+	}
+	if got := p.states(); got != 6 {
+		t.Fatalf("states() = %d, want 6", got)
+	}
+	for _, tt := range tests {
+		if got := p.advance(tt.s, tt.add); got != tt.want {
+			t.Errorf("advance(%d, %v) = %d, want %d", tt.s, tt.add, got, tt.want)
+		}
+	}
+}
+
+func TestBlueprintSample(t *testing.T) {
+	e := &Exam{ID: "t", Blueprint: &Blueprint{
+		Rules:       []BlueprintRule{rule(1, "a"), rule(1, "b")},
+		Constraints: []BlueprintConstraint{pictures(1)},
+	}}
+	if problems := e.prepare(blueprintBank()); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+
+	seen := make(map[string]int)
+	for range 2000 {
+		qs := e.Sample()
+		if len(qs) != e.Size() {
+			t.Fatalf("Sample() returned %d questions, want %d", len(qs), e.Size())
+		}
+		if !slices.ContainsFunc(qs, func(q Question) bool { return strings.Contains(q.Question, "picture") }) {
+			t.Fatalf("Sample() = %v violates the picture constraint", qs)
+		}
+		if !slices.Contains(qs[0].Tags, "a") || !slices.Equal(qs[1].Tags, []string{"b"}) {
+			t.Fatalf("Sample() = %v does not follow the rules", qs)
+		}
+		seen[fmt.Sprint(qs[0].ID, qs[1].ID)]++
+	}
+	// Все 7 допустимых наборов выпадают, и примерно поровну (ожидание ~286)
+	if len(seen) != 7 {
+		t.Errorf("got %d distinct forms, want 7: %v", len(seen), seen)
+	}
+	for form, n := range seen {
+		if n < 150 {
+			t.Errorf("form %s drawn %d times out of 2000", form, n)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Типы вопросов
+const (
+	TypeSingle   = "single"   // один правильный вариант (Answer), по умолчанию
+	TypeMultiple = "multiple" // несколько правильных вариантов (Answers)
+	TypeMatching = "matching" // сопоставление Prompts с Options (Matches)
+	TypeOrdering = "ordering" // расставить Options по порядку; ключ — порядок в банке
+	TypeText     = "text"     // ответ строкой: Accept и/или Patterns
+	TypeNumeric  = "numeric"  // ответ числом: Value ± Tolerance
+	TypeHotspot  = "hotspot"  // клик по картинке Image: попасть в одну из Regions
+)
+
+// Kind — тип вопроса с учётом значения по умолчанию
+func (q Question) Kind() string {
+	if q.Type == "" {
+		return TypeSingle
+	}
+	return q.Type
+}
+
+// HasOptions — выбирает ли студент из списка вариантов
+func (q Question) HasOptions() bool {
+	switch q.Kind() {
+	case TypeText, TypeNumeric, TypeHotspot:
+		return false
+	}
+	return true
+}
+
+// Ключ не определён (Answer: -1, пустые Answers/Matches/Accept) — вопрос не идёт в зачёт
+func (q Question) Unscored() bool {
+	switch q.Kind() {
+	case TypeMultiple:
+		return len(q.Answers) == 0 && len(q.OptionScores) == 0
+	case TypeMatching:
+		return len(q.Matches) == 0
+	case TypeOrdering:
+		return false
+	case TypeText:
+		return len(q.Accept) == 0 && len(q.Patterns) == 0
+	case TypeNumeric:
+		return q.Value == nil
+	case TypeHotspot:
+		return len(q.Regions) == 0
+	default:
+		return q.key() < 0 && len(q.OptionScores) == 0
+	}
+}
+
+// checkKey — структурная проверка ключа в зависимости от типа вопроса
+func checkKey(q Question) []string {
+	var problems []string
+	switch q.Kind() {
+	case TypeSingle:
+		// Пропущенный answer не должен молча стать вариантом 0:
+		// нерешённый ключ помечается явно, answer: -1
+		switch {
+		case q.Answer == nil && len(q.OptionScores) == 0:
+			problems = append(problems, "answer required (-1 if the key is not known yet)")
+		case q.Answer != nil && (*q.Answer < -1 || *q.Answer >= len(q.Options)):
+			problems = append(problems, fmt.Sprintf("answer %d out of range [-1, %d)", *q.Answer, len(q.Options)))
+		}
+	case TypeMultiple:
+		if p := checkIndexes(q.Answers, len(q.Options)); p != "" {
+			problems = append(problems, "answers: "+p)
+		}
+	case TypeMatching:
+		if len(q.Prompts) < 2 {
+			problems = append(problems, "at least 2 prompts required")
+		}
+		if len(q.Matches) > 0 && len(q.Matches) != len(q.Prompts) {
+			problems = append(problems, fmt.Sprintf("matches: %d entries for %d prompts", len(q.Matches), len(q.Prompts)))
+		}
+		for _, m := range q.Matches {
+			if m < 0 || m >= len(q.Options) {
+				problems = append(problems, fmt.Sprintf("matches: target %d out of range [0, %d)", m, len(q.Options)))
+			}
+		}
+	case TypeOrdering:
+		if len(q.Pinned) > 0 {
+			problems = append(problems, "pinned is not allowed for ordering questions")
+		}
+	case TypeText:
+		for _, p := range q.Patterns {
+			if _, err := compileAnswerPattern(p, q.CaseSensitive); err != nil {
+				problems = append(problems, fmt.Sprintf("pattern %q: %v", p, err))
+			}
+		}
+	case TypeNumeric:
+		if q.Tolerance < 0 {
+			problems = append(problems, "tolerance must not be negative")
+		}
+	case TypeHotspot:
+		if q.Image == "" {
+			problems = append(problems, "image required")
+		}
+		for i, r := range q.Regions {
+			if len(r) < 3 {
+				problems = append(problems, fmt.Sprintf("region #%d: at least 3 points required", i+1))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown question type %q", q.Type))
+	}
+	if q.Kind() != TypeHotspot && (q.Image != "" || len(q.Regions) > 0) {
+		problems = append(problems, fmt.Sprintf("image and regions are not used by %s questions", q.Kind()))
+	}
+	return problems
+}
+
+// checkHotspotImage проверяет картинку hotspot (m == nil — её нет в банке)
+// и, если размер картинки известен, что области не выходят за её края
+func checkHotspotImage(q Question, m *MediaAsset) []string {
+	if m == nil {
+		return []string{fmt.Sprintf("unknown image %q", q.Image)}
+	}
+	if m.Type != "image" {
+		return []string{fmt.Sprintf("image %q is %s, not an image", q.Image, m.Type)}
+	}
+	if m.width == 0 || m.height == 0 {
+		return nil
+	}
+	var problems []string
+	for i, r := range q.Regions {
+		for _, p := range r {
+			if p.X < 0 || p.Y < 0 || p.X > float64(m.width) || p.Y > float64(m.height) {
+				problems = append(problems, fmt.Sprintf("region #%d: point (%g, %g) outside %dx%d image",
+					i+1, p.X, p.Y, m.width, m.height))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// checkIndexes проверяет набор индексов вариантов: в диапазоне и без повторов
+func checkIndexes(idx []int, n int) string {
+	seen := make(map[int]bool, len(idx))
+	for _, i := range idx {
+		if i < 0 || i >= n {
+			return fmt.Sprintf("index %d out of range [0, %d)", i, n)
+		}
+		if seen[i] {
+			return fmt.Sprintf("index %d repeated", i)
+		}
+		seen[i] = true
+	}
+	return ""
+}
+
+// validateAnswers проверяет, что каждый ответ относится к вопросу попытки,
+// встречается не больше одного раза и выбирает существующие варианты
+func validateAnswers(qByID map[int]Question, answers []Answer) []AnswerProblem {
+	var problems []AnswerProblem
+	seen := make(map[int]int, len(answers)) // question_id -> позиция первого ответа
+	for i, a := range answers {
+		q, exists := qByID[a.QuestionID]
+		if !exists {
+			problems = append(problems, AnswerProblem{Index: i, QuestionID: a.QuestionID,
+				Error: "unknown question_id"})
+			continue
+		}
+		if first, dup := seen[a.QuestionID]; dup {
+			problems = append(problems, AnswerProblem{Index: i, QuestionID: a.QuestionID,
+				Error: fmt.Sprintf("duplicate answer (first at index %d)", first)})
+			continue
+		}
+		seen[a.QuestionID] = i
+		if msg := checkAnswer(q, a); msg != "" {
+			problems = append(problems, AnswerProblem{Index: i, QuestionID: a.QuestionID, Error: msg})
+		}
+	}
+	return problems
+}
+
+// Ограничение на длину текстового ответа
+const maxTextAnswer = 1000
+
+// checkAnswer — проверка формы ответа на конкретный вопрос
+func checkAnswer(q Question, a Answer) string {
+	switch q.Kind() {
+	case TypeMultiple:
+		if p := checkIndexes(a.Choices, len(q.Options)); p != "" {
+			return "choices: " + p
+		}
+	case TypeMatching:
+		prompts := make([]int, len(a.Pairs))
+		for i, p := range a.Pairs {
+			if p.Target < 0 || p.Target >= len(q.Options) {
+				return fmt.Sprintf("pairs: target %d out of range [0, %d)", p.Target, len(q.Options))
+			}
+			prompts[i] = p.Prompt
+		}
+		if p := checkIndexes(prompts, len(q.Prompts)); p != "" {
+			return "pairs: prompt " + p
+		}
+	case TypeOrdering:
+		if len(a.Order) == 0 {
+			return ""
+		}
+		if len(a.Order) != len(q.Options) {
+			return fmt.Sprintf("order: %d items, want all %d", len(a.Order), len(q.Options))
+		}
+		if p := checkIndexes(a.Order, len(q.Options)); p != "" {
+			return "order: " + p
+		}
+	case TypeText:
+		if len(a.Text) > maxTextAnswer {
+			return fmt.Sprintf("text longer than %d bytes", maxTextAnswer)
+		}
+	case TypeNumeric:
+		if a.Value != nil && (math.IsNaN(*a.Value) || math.IsInf(*a.Value, 0)) {
+			return "value must be a finite number"
+		}
+	case TypeHotspot:
+		if p := a.Point; p != nil && (math.IsNaN(p.X) || math.IsNaN(p.Y) || math.IsInf(p.X, 0) || math.IsInf(p.Y, 0)) {
+			return "point must have finite coordinates"
+		}
+	default:
+		if a.Choice < -1 || a.Choice >= len(q.Options) {
+			return fmt.Sprintf("choice %d out of range [-1, %d)", a.Choice, len(q.Options))
+		}
+	}
+	return ""
+}
+
+// gradeAnswer оценивает ответ и собирает пункт разбора. Ответ пришёл
+// в порядке показа — сравниваем в индексах банка, а в разборе всё
+// показываем так, как видел студент.
+func gradeAnswer(at *Attempt, q Question, a Answer) ReviewItem {
+	item := ReviewItem{
+		QuestionID:    q.ID,
+		Type:          q.Kind(),
+		Question:      q.Question,
+		Options:       at.shownOptions(q),
+		CorrectChoice: -1,
+		UserChoice:    a.Choice,
+		Explanation:   q.Explanation,
+		Links:         q.Links,
+		Skipped:       !answered(q, a),
+		Unscored:      q.Unscored(),
+	}
+	for i := range q.OptionScores {
+		item.OptionScores = append(item.OptionScores, q.OptionScores[at.toBank(q.ID, i)])
+	}
+
+	switch q.Kind() {
+	case TypeMultiple:
+		item.UserChoices = a.Choices
+		for _, i := range q.Answers {
+			item.CorrectChoices = append(item.CorrectChoices, at.toShown(q.ID, i))
+		}
+		if len(q.Answers) == 0 {
+			// Ключ задан только оценками вариантов — правильные те, что дают баллы
+			for i, s := range item.OptionScores {
+				if s > 0 {
+					item.CorrectChoices = append(item.CorrectChoices, i)
+				}
+			}
+		}
+		slices.Sort(item.CorrectChoices)
+		if !item.Unscored {
+			picked := make([]int, len(a.Choices))
+			for i, c := range a.Choices {
+				picked[i] = at.toBank(q.ID, c)
+			}
+			if len(q.OptionScores) > 0 {
+				item.Credit = optionCredit(q, picked)
+			} else {
+				item.Credit = gradeMultiple(q, picked)
+			}
+		}
+	case TypeMatching:
+		item.Prompts = q.Prompts
+		item.Pairs, item.Credit = gradeMatching(at, q, a.Pairs)
+		if item.Unscored {
+			item.Credit = 0
+		}
+	case TypeOrdering:
+		item.UserOrder = a.Order
+		item.CorrectOrder = make([]int, len(q.Options))
+		for i := range q.Options {
+			item.CorrectOrder[i] = at.toShown(q.ID, i)
+		}
+		if len(a.Order) > 0 {
+			// В индексах банка правильная последовательность — 0, 1, 2, ...
+			seq := make([]int, len(a.Order))
+			for i, c := range a.Order {
+				seq[i] = at.toBank(q.ID, c)
+			}
+			item.Credit = gradeOrdering(q, seq)
+		}
+	case TypeText:
+		item.UserText = a.Text
+		item.Accepted = q.Accept
+		if !item.Unscored && matchText(q, a.Text) {
+			item.Credit = 1
+		}
+	case TypeNumeric:
+		item.UserValue = a.Value
+		item.CorrectValue = q.Value
+		item.Tolerance = q.Tolerance
+		if !item.Unscored && a.Value != nil && matchValue(q, *a.Value) {
+			item.Credit = 1
+		}
+	case TypeHotspot:
+		item.UserPoint = a.Point
+		item.Regions = q.Regions
+		if a.Point != nil && slices.ContainsFunc(q.Regions, func(r Polygon) bool { return r.Contains(*a.Point) }) {
+			item.Credit = 1
+		}
+	default:
+		item.CorrectChoice = at.toShown(q.ID, q.key())
+		if len(q.OptionScores) > 0 {
+			if q.key() < 0 {
+				best := slices.Index(q.OptionScores, slices.Max(q.OptionScores))
+				item.CorrectChoice = at.toShown(q.ID, best)
+			}
+			if a.Choice >= 0 {
+				item.Credit = optionCredit(q, []int{at.toBank(q.ID, a.Choice)})
+			}
+		} else if !item.Unscored && at.toBank(q.ID, a.Choice) == q.key() {
+			item.Credit = 1
+		}
+	}
+	return item
+}
+
+// answered — дал ли студент хоть какой-то ответ на вопрос
+func answered(q Question, a Answer) bool {
+	switch q.Kind() {
+	case TypeMultiple:
+		return len(a.Choices) > 0
+	case TypeMatching:
+		return len(a.Pairs) > 0
+	case TypeOrdering:
+		return len(a.Order) > 0
+	case TypeText:
+		return strings.TrimSpace(a.Text) != ""
+	case TypeNumeric:
+		return a.Value != nil
+	case TypeHotspot:
+		return a.Point != nil
+	default:
+		return a.Choice >= 0
+	}
+}
+
+// gradeMultiple: без Partial — только точное совпадение с ключом;
+// с Partial — доля угаданных вариантов минус доля лишних, но не меньше нуля
+func gradeMultiple(q Question, picked []int) float64 {
+	hits, misses := 0, 0
+	for _, c := range picked {
+		if slices.Contains(q.Answers, c) {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	if !q.Partial {
+		if hits == len(q.Answers) && misses == 0 {
+			return 1
+		}
+		return 0
+	}
+	return max(0, float64(hits-misses)/float64(len(q.Answers)))
+}
+
+// gradeMatching разбирает сопоставление по каждой строке; балл —
+// доля правильно сопоставленных строк (частичный зачёт всегда)
+func gradeMatching(at *Attempt, q Question, pairs []Pair) ([]PairResult, float64) {
+	user := make(map[int]int, len(pairs)) // prompt -> показанный target
+	for _, p := range pairs {
+		user[p.Prompt] = p.Target
+	}
+
+	results := make([]PairResult, len(q.Prompts))
+	correct := 0
+	for i := range q.Prompts {
+		r := PairResult{Prompt: i, Target: -1, CorrectTarget: -1}
+		if t, ok := user[i]; ok {
+			r.Target = t
+		}
+		if i < len(q.Matches) {
+			r.CorrectTarget = at.toShown(q.ID, q.Matches[i])
+			r.Correct = r.Target >= 0 && at.toBank(q.ID, r.Target) == q.Matches[i]
+		}
+		if r.Correct {
+			correct++
+		}
+		results[i] = r
+	}
+	return results, float64(correct) / float64(len(q.Prompts))
+}
+
+// gradeOrdering: без Partial — только точное совпадение; с Partial —
+// 1 минус доля переставленных пар (нормированное расстояние Кендалла)
+func gradeOrdering(q Question, seq []int) float64 {
+	inversions := 0
+	for i := range seq {
+		for j := i + 1; j < len(seq); j++ {
+			if seq[i] > seq[j] {
+				inversions++
+			}
+		}
+	}
+	if !q.Partial {
+		if inversions == 0 {
+			return 1
+		}
+		return 0
+	}
+	pairs := len(seq) * (len(seq) - 1) / 2
+	return 1 - float64(inversions)/float64(pairs)
+}
+
+// normalizeAnswer убирает пробелы по краям и схлопывает внутренние,
+// а без CaseSensitive ещё и приводит к нижнему регистру
+func normalizeAnswer(s string, caseSensitive bool) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// compileAnswerPattern — шаблон должен совпасть со всем ответом целиком
+func compileAnswerPattern(p string, caseSensitive bool) (*regexp.Regexp, error) {
+	flags := ""
+	if !caseSensitive {
+		flags = "(?i)"
+	}
+	return regexp.Compile(flags + `^(?:` + p + `)$`)
+}
+
+// matchText сравнивает ответ со списком Accept после нормализации
+// и с шаблонами Patterns
+func matchText(q Question, text string) bool {
+	got := normalizeAnswer(text, q.CaseSensitive)
+	if got == "" {
+		return false
+	}
+	for _, want := range q.Accept {
+		if got == normalizeAnswer(want, q.CaseSensitive) {
+			return true
+		}
+	}
+	for _, p := range q.Patterns {
+		re, err := compileAnswerPattern(p, q.CaseSensitive)
+		if err == nil && re.MatchString(strings.TrimSpace(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValue — попадает ли число в допуск вокруг Value. Небольшой
+// относительный запас нужен, чтобы граница допуска засчитывалась с обеих
+// сторон: |0.4-0.3| в float64 чуть больше 0.1.
+func matchValue(q Question, v float64) bool {
+	return math.Abs(v-*q.Value) <= q.Tolerance+1e-9*max(1, math.Abs(*q.Value))
+}
+
+// Contains — попадает ли точка внутрь многоугольника (метод лучей:
+// считаем, сколько рёбер пересекает горизонтальный луч вправо от точки).
+// Точка на границе считается попаданием с любой стороны фигуры.
+func (r Polygon) Contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if onSegment(p, a, b) {
+			return true
+		}
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// onSegment — лежит ли p на отрезке ab (с допуском на округление координат)
+func onSegment(p, a, b Point) bool {
+	const eps = 1e-9
+	cross := (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+	if math.Abs(cross) > eps*max(1, math.Hypot(b.X-a.X, b.Y-a.Y)) {
+		return false
+	}
+	return p.X >= min(a.X, b.X)-eps && p.X <= max(a.X, b.X)+eps &&
+		p.Y >= min(a.Y, b.Y)-eps && p.Y <= max(a.Y, b.Y)+eps
+}
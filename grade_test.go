@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGradeOrdering(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial bool
+		seq     []int
+		want    float64
+	}{
+		{"exact", false, []int{0, 1, 2, 3}, 1},
+		{"one swap, all or nothing", false, []int{1, 0, 2, 3}, 0},
+		{"exact, partial", true, []int{0, 1, 2, 3}, 1},
+		{"one adjacent swap", true, []int{1, 0, 2, 3}, 1 - 1.0/6},
+		{"first moved to the end", true, []int{1, 2, 3, 0}, 1 - 3.0/6},
+		{"reversed", true, []int{3, 2, 1, 0}, 0},
+		{"two items swapped", true, []int{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Question{Type: TypeOrdering, Partial: tt.partial}
+			if got := gradeOrdering(q, tt.seq); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("gradeOrdering(%v) = %v, want %v", tt.seq, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	num := func(v, tol float64) Question { return Question{Type: TypeNumeric, Value: &v, Tolerance: tol} }
+	tests := []struct {
+		name string
+		q    Question
+		v    float64
+		want bool
+	}{
+		{"exact", num(0.3, 0.1), 0.3, true},
+		{"lower edge", num(0.3, 0.1), 0.2, true},
+		{"upper edge", num(0.3, 0.1), 0.4, true},
+		{"below", num(0.3, 0.1), 0.19, false},
+		{"above", num(0.3, 0.1), 0.41, false},
+		{"no tolerance", num(0.3, 0), 0.1 + 0.2, true},
+		{"no tolerance, off", num(0.3, 0), 0.31, false},
+		{"large value, lower edge", num(1500, 25), 1475, true},
+		{"large value, upper edge", num(1500, 25), 1525, true},
+		{"large value, above", num(1500, 25), 1525.5, false},
+		{"negative value, edges", num(-2.5, 0.5), -2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchValue(tt.q, tt.v); got != tt.want {
+				t.Errorf("matchValue(%v ± %v, %v) = %v, want %v", *tt.q.Value, tt.q.Tolerance, tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	square := Polygon{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	// Буква L: вырез в правом верхнем углу
+	ell := Polygon{{0, 0}, {10, 0}, {10, 4}, {4, 4}, {4, 10}, {0, 10}}
+	triangle := Polygon{{0, 0}, {10, 0}, {5, 10}}
+
+	tests := []struct {
+		name string
+		poly Polygon
+		p    Point
+		want bool
+	}{
+		{"square centre", square, Point{5, 5}, true},
+		{"square outside right", square, Point{11, 5}, false},
+		{"square outside below", square, Point{5, -0.1}, false},
+		{"square left edge", square, Point{0, 5}, true},
+		{"square right edge", square, Point{10, 5}, true},
+		{"square bottom edge", square, Point{5, 0}, true},
+		{"square top edge", square, Point{5, 10}, true},
+		{"square corner", square, Point{10, 10}, true},
+		{"square vertex", square, Point{0, 0}, true},
+		{"ell inside lower arm", ell, Point{8, 2}, true},
+		{"ell notch", ell, Point{8, 8}, false},
+		{"ell inner corner", ell, Point{4, 4}, true},
+		{"ell notch edge", ell, Point{7, 4}, true},
+		{"ray through vertex", ell, Point{2, 4}, true},
+		{"triangle slanted edge", triangle, Point{2.5, 5}, true},
+		{"triangle beside slanted edge", triangle, Point{2, 5}, false},
+		{"triangle apex", triangle, Point{5, 10}, true},
+		{"above triangle apex", triangle, Point{5, 10.5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.poly.Contains(tt.p); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
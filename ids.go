@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// test_id — единственное, что нужно знать, чтобы сдать или посмотреть
+// попытку, поэтому он берётся из crypto/rand: 128 бит случайности.
+//
+// С ключом -id-secret test_id ещё и подписывается: "test-<random>.<mac>",
+// где mac — HMAC-SHA256 от случайной части. Подделанный или подобранный
+// id отсекается до обращения к хранилищу и попадает в лог.
+var idSecret []byte
+
+const (
+	testIDPrefix = "test-"
+	testIDBytes  = 16 // случайная часть
+	testIDMAC    = 16 // сколько байт HMAC оставлять в подписи
+	testIDLogLen = 40 // сколько символов отвергнутого id писать в лог
+)
+
+var (
+	idEncoding      = base32.StdEncoding.WithPadding(base32.NoPadding)
+	errForgedTestID = errors.New("invalid test_id")
+)
+
+func randomTestID() string {
+	b := make([]byte, testIDBytes)
+	rand.Read(b)
+	id := testIDPrefix + strings.ToLower(idEncoding.EncodeToString(b))
+	if idSecret == nil {
+		return id
+	}
+	return id + "." + testIDSignature(id)
+}
+
+func testIDSignature(id string) string {
+	mac := hmac.New(sha256.New, idSecret)
+	mac.Write([]byte(id))
+	return strings.ToLower(idEncoding.EncodeToString(mac.Sum(nil)[:testIDMAC]))
+}
+
+// checkTestID проверяет подпись test_id (без ключа — ничего не проверяет).
+// В ошибку попадает начало отвергнутого id, чтобы по логу было видно подбор.
+func checkTestID(testID string) error {
+	if idSecret == nil {
+		return nil
+	}
+	id, sig, ok := strings.Cut(testID, ".")
+	if !ok || !strings.HasPrefix(id, testIDPrefix) ||
+		!hmac.Equal([]byte(sig), []byte(testIDSignature(id))) {
+		return fmt.Errorf("%w %q", errForgedTestID, testID[:min(len(testID), testIDLogLen)])
+	}
+	return nil
+}
+
+// findAttempt — попытка по test_id с проверкой подписи
+func findAttempt(testID string) (*Attempt, error) {
+	if err := checkTestID(testID); err != nil {
+		return nil, err
+	}
+	a, ok := store.Get(testID)
+	if !ok {
+		return nil, errAttemptNotFound
+	}
+	return a, nil
+}
@@ -1,908 +1,400 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"log"
+	"maps"
 	"math/rand"
 	"net/http"
-	"sync"
+	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
 // Полная серверная модель (с правильным ответом)
 type Question struct {
 	ID       int      `json:"id"`
+	Type     string   `json:"type,omitempty"` // single (по умолчанию), multiple, matching, ordering, text, numeric, hotspot
 	Question string   `json:"question"`
-	Options  []string `json:"options"`
-	Answer   int      `json:"answer"` // индекс правильного варианта
+	Tags     []string `json:"tags,omitempty"`    // темы: virtualization, cabling, printers...
+	Prompts  []string `json:"prompts,omitempty"` // что сопоставляется с Options (matching)
+	Options  []string `json:"options,omitempty"` // для ordering — в правильном порядке
+	Answer   *int     `json:"answer,omitempty"`  // индекс правильного варианта (single), -1 — ключ не определён
+	Answers  []int    `json:"answers,omitempty"` // индексы правильных вариантов (multiple)
+	Matches  []int    `json:"matches,omitempty"` // Matches[i] — вариант для Prompts[i] (matching)
+
+	Accept        []string `json:"accept,omitempty"`         // принимаемые ответы (text)
+	Patterns      []string `json:"patterns,omitempty"`       // регулярные выражения на весь ответ (text)
+	CaseSensitive bool     `json:"case_sensitive,omitempty"` // text: различать регистр
+	Value         *float64 `json:"value,omitempty"`          // правильное число (numeric)
+	Tolerance     float64  `json:"tolerance,omitempty"`      // допустимое отклонение (numeric)
+
+	Image   string    `json:"image,omitempty"`   // id картинки, по которой кликают (hotspot)
+	Regions []Polygon `json:"regions,omitempty"` // правильные области в пикселях картинки (hotspot)
+
+	Explanation string `json:"explanation,omitempty"` // пояснение к ответу для разбора
+	Links       []Link `json:"links,omitempty"`       // материалы курса по вопросу
+
+	Points       float64   `json:"points,omitempty"`        // сколько стоит вопрос (по умолчанию 1)
+	Penalty      float64   `json:"penalty,omitempty"`       // штраф за неверный ответ (политика negative)
+	OptionScores []float64 `json:"option_scores,omitempty"` // доля баллов за каждый вариант, от -1 до 1 (single, multiple); минус снимает баллы только в политике negative
+
+	Partial bool     `json:"partial,omitempty"` // частичный зачёт вместо "всё или ничего" (multiple, ordering)
+	Media   []string `json:"media,omitempty"`   // id вложений из банка
+	Pinned  []int    `json:"pinned,omitempty"`  // варианты, которые не перемешиваются
 }
 
+// key — индекс правильного варианта single (-1, если ключ не определён или не задан)
+func (q Question) key() int {
+	if q.Answer == nil {
+		return -1
+	}
+	return *q.Answer
+}
+
+// HasAnyTag — относится ли вопрос хотя бы к одной из тем (без учёта регистра)
+func (q Question) HasAnyTag(tags []string) bool {
+	for _, t := range q.Tags {
+		for _, want := range tags {
+			if strings.EqualFold(t, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasMedia — есть ли у вопроса вложения (включая картинку hotspot)
+func (q Question) HasMedia() bool {
+	return len(q.Media) > 0 || q.Image != ""
+}
+
+// Ссылка на материал курса
+type Link struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Точка на картинке в пикселях, от левого верхнего угла
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Многоугольник — вершины по порядку обхода
+type Polygon []Point
+
 // Публичная модель для фронта (без правильного ответа)
 type PublicQuestion struct {
-	ID       int      `json:"id"`
-	Question string   `json:"question"`
-	Options  []string `json:"options"`
+	ID       int           `json:"id"`
+	Type     string        `json:"type"`
+	Question string        `json:"question"`
+	Tags     []string      `json:"tags,omitempty"`
+	Prompts  []string      `json:"prompts,omitempty"`
+	Options  []string      `json:"options,omitempty"`
+	Media    []PublicMedia `json:"media,omitempty"`
+	Image    *PublicMedia  `json:"image,omitempty"` // картинка для клика (hotspot)
 }
 
 type StartRequest struct {
-	User string `json:"user"`
+	User       string   `json:"user"`
+	Exam       string   `json:"exam,omitempty"`       // id экзамена (пусто — "default", если он есть)
+	Categories []string `json:"categories,omitempty"` // только вопросы из этих тем
 }
 
 type StartResponse struct {
 	Success   bool             `json:"success"`
 	TestID    string           `json:"test_id"`
 	Questions []PublicQuestion `json:"test"`
+	Deadline  *time.Time       `json:"deadline,omitempty"` // сдать до (по часам сервера)
 }
 
 // Запрос с ответами пользователя
 type SubmitRequest struct {
-	TestID  string `json:"test_id"`
-	User    string `json:"user"`
-	Answers []struct {
-		QuestionID int `json:"question_id"`
-		Choice     int `json:"choice"`
-	} `json:"answers"`
+	TestID  string   `json:"test_id"`
+	User    string   `json:"user"`
+	Answers []Answer `json:"answers"`
+
+	// Взять автосохранённые ответы; присланные в Answers их дополняют
+	// и перекрывают
+	UseSaved bool `json:"use_saved,omitempty"`
+}
+
+// Ответ на один вопрос. Choice — для single (-1 — вопрос пропущен),
+// Choices — для multiple, Pairs — для matching, Order — для ordering
+// (перестановка показанных индексов), Text — для text, Value — для numeric,
+// Point — для hotspot (пусто — пропущен).
+type Answer struct {
+	QuestionID int      `json:"question_id"`
+	Choice     int      `json:"choice"`
+	Choices    []int    `json:"choices,omitempty"`
+	Pairs      []Pair   `json:"pairs,omitempty"`
+	Order      []int    `json:"order,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Value      *float64 `json:"value,omitempty"`
+	Point      *Point   `json:"point,omitempty"`
+}
+
+// Пара в ответе на matching: индекс строки Prompts и показанный индекс варианта
+type Pair struct {
+	Prompt int `json:"prompt"`
+	Target int `json:"target"`
 }
 
-// Ответ с баллом и подробным разбором
+// Проблема с одним из ответов в запросе
+type AnswerProblem struct {
+	Index      int    `json:"index"` // позиция в answers
+	QuestionID int    `json:"question_id"`
+	Error      string `json:"error"`
+}
+
+// Ответ с баллом и подробным разбором. Score и Total — в баллах
+// с учётом веса вопросов; вопросы без ключа в них не входят, их id — в Unscored.
 type SubmitResponse struct {
-	Success bool         `json:"success"`
-	Score   int          `json:"score"`
-	Total   int          `json:"total"`
-	Results []ReviewItem `json:"results"`
+	Success  bool         `json:"success"`
+	User     string       `json:"user"` // кто сдавал: совпадает с начавшим попытку
+	Score    float64      `json:"score"`
+	Total    float64      `json:"total"`
+	Percent  float64      `json:"percent"`
+	Grade    string       `json:"grade,omitempty"` // оценка по шкале экзамена, если она задана
+	Passed   bool         `json:"passed"`
+	Unscored []int        `json:"unscored"`
+	Results  []ReviewItem `json:"results"`
+
+	// Разбивка по темам; вопрос с несколькими темами считается в каждой
+	Categories map[string]*CategoryScore `json:"categories,omitempty"`
+
+	// Политика разбора, по которой собран ответ, и когда откроется ключ
+	// (для after_close до закрытия экзамена)
+	Review         string     `json:"review"`
+	KeyAvailableAt *time.Time `json:"key_available_at,omitempty"`
+
+	// Сдача опоздала, и проверены сохранённые ответы, а не присланные
+	AutoGraded bool `json:"auto_graded,omitempty"`
+}
+
+type CategoryScore struct {
+	Score float64 `json:"score"`
+	Total float64 `json:"total"`
 }
 
 type ReviewItem struct {
-	QuestionID    int      `json:"question_id"`
-	Question      string   `json:"question"`
-	Options       []string `json:"options"`
-	CorrectChoice int      `json:"correct_choice"`
-	UserChoice    int      `json:"user_choice"`
+	QuestionID     int          `json:"question_id"`
+	Type           string       `json:"type"`
+	Question       string       `json:"question"`
+	Options        []string     `json:"options"`
+	CorrectChoice  int          `json:"correct_choice"` // -1, если у вопроса не один вариант
+	UserChoice     int          `json:"user_choice"`
+	CorrectChoices []int        `json:"correct_choices,omitempty"`
+	OptionScores   []float64    `json:"option_scores,omitempty"` // в порядке показа
+	UserChoices    []int        `json:"user_choices,omitempty"`
+	Prompts        []string     `json:"prompts,omitempty"`
+	Pairs          []PairResult `json:"pairs,omitempty"`
+	CorrectOrder   []int        `json:"correct_order,omitempty"`
+	UserOrder      []int        `json:"user_order,omitempty"`
+	Accepted       []string     `json:"accepted,omitempty"`
+	UserText       string       `json:"user_text,omitempty"`
+	CorrectValue   *float64     `json:"correct_value,omitempty"`
+	Tolerance      float64      `json:"tolerance,omitempty"`
+	UserValue      *float64     `json:"user_value,omitempty"`
+	Image          *PublicMedia `json:"image,omitempty"`
+	Regions        []Polygon    `json:"regions,omitempty"`
+	UserPoint      *Point       `json:"user_point,omitempty"`
+	Explanation    string       `json:"explanation,omitempty"`
+	Links          []Link       `json:"links,omitempty"`
+	Credit         float64      `json:"credit"`     // доля зачёта за вопрос, от 0 до 1 (с option_scores — от -1, в минус баллы уходят только в политике negative)
+	Points         float64      `json:"points"`     // начислено по политике экзамена, может быть меньше нуля
+	MaxPoints      float64      `json:"max_points"` // сколько стоит вопрос
+	Skipped        bool         `json:"skipped,omitempty"`
+	Unscored       bool         `json:"unscored,omitempty"`
+}
+
+// Разбор одной строки matching; -1 — пара не указана / ключа нет
+type PairResult struct {
+	Prompt        int  `json:"prompt"`
+	Target        int  `json:"target"`
+	CorrectTarget int  `json:"correct_target"`
+	Correct       bool `json:"correct"`
 }
 
-// Хранилище попыток по test_id
-type TestStore struct {
-	mu        sync.RWMutex
-	testMap   map[string][]Question // test_id -> полный список вопросов с ответами
-	expiresAt map[string]time.Time  // test_id -> время истечения (необязательно)
-	ttl       time.Duration
+// Попытка: снимок вопросов (с ответами) на момент старта.
+// Проверяется всегда по этому снимку, даже если банк уже перезагружен.
+type Attempt struct {
+	Questions   []Question      `json:"questions"` // в порядке показа
+	BankVersion string          `json:"bank_version"`
+	Exam        *Exam           `json:"exam"`             // описание экзамена на момент старта
+	Result      *SubmitResponse `json:"result,omitempty"` // полный результат после сдачи (без учёта политики разбора)
+
+	// Вложения вопросов в версии банка на момент старта: id -> ссылка
+	Media map[string]PublicMedia `json:"media,omitempty"`
+
+	User   string `json:"user"`             // кто начал попытку: сдавать её может только он
+	State  string `json:"state"`            // см. Attempt* ниже
+	Digest string `json:"digest,omitempty"` // хэш принятых ответов: повтор той же сдачи не ошибка
+
+	StartedAt time.Time  `json:"started_at"`
+	Deadline  *time.Time `json:"deadline,omitempty"` // по лимиту времени экзамена
+	Saved     []Answer   `json:"saved,omitempty"`    // последние сохранённые ответы (для autograde)
+
+	// question_id -> порядок вариантов: OptionOrder[id][i] — индекс в банке
+	// варианта, показанного на позиции i
+	OptionOrder map[int][]int `json:"option_order"`
 }
 
-func NewTestStore(ttl time.Duration) *TestStore {
-	return &TestStore{
-		testMap:   make(map[string][]Question),
-		expiresAt: make(map[string]time.Time),
-		ttl:       ttl,
+// Состояния попытки
+const (
+	AttemptStarted    = "started"     // вопросы выданы
+	AttemptInProgress = "in_progress" // студент уже сохранял ответы
+	AttemptSubmitted  = "submitted"   // ответы приняты и проверены, повторная сдача запрещена
+	AttemptExpired    = "expired"     // срок вышел до сдачи
+	AttemptVoided     = "voided"      // аннулирована администратором
+)
+
+// checkOpen — можно ли ещё сдавать попытку
+func (a *Attempt) checkOpen(now time.Time) error {
+	switch {
+	case a.State == AttemptSubmitted:
+		return errAlreadySubmitted
+	case a.State == AttemptVoided:
+		return errAttemptVoided
+	case a.Overdue(now):
+		return errTimeLimit
+	case a.State == AttemptExpired:
+		return errAttemptExpired
 	}
+	return nil
 }
 
-func (s *TestStore) Put(testID string, qs []Question) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.testMap[testID] = qs
-	if s.ttl > 0 {
-		s.expiresAt[testID] = time.Now().Add(s.ttl)
+// checkUser — тот ли пользователь обращается к попытке, что её начал
+func (a *Attempt) checkUser(user string) error {
+	if strings.TrimSpace(user) != a.User {
+		return errWrongUser
 	}
+	return nil
 }
 
-func (s *TestStore) Get(testID string) ([]Question, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	qs, ok := s.testMap[testID]
-	if !ok {
-		return nil, false
+// Overdue — прошли ли дедлайн и grace
+func (a *Attempt) Overdue(now time.Time) bool {
+	return a.Deadline != nil && now.After(a.Deadline.Add(a.Exam.Grace.Duration))
+}
+
+// lifetime — сколько хранить несданную попытку: ttl, а с дедлайном — ещё
+// ttl после него, чтобы поздняя сдача получила внятный ответ или автопроверку
+func (a *Attempt) lifetime(ttl time.Duration) time.Duration {
+	if a.Deadline == nil {
+		return ttl
 	}
-	if s.ttl > 0 {
-		if exp, ok2 := s.expiresAt[testID]; ok2 && time.Now().After(exp) {
-			return nil, false
-		}
+	return time.Until(a.Deadline.Add(a.Exam.Grace.Duration)) + ttl
+}
+
+// Closed — попытка сдана или аннулирована и больше не меняется
+func (a *Attempt) Closed() bool {
+	return a.State == AttemptSubmitted || a.State == AttemptVoided
+}
+
+// questionsByID — вопросы попытки по id
+func (a *Attempt) questionsByID() map[int]Question {
+	m := make(map[int]Question, len(a.Questions))
+	for _, q := range a.Questions {
+		m[q.ID] = q
 	}
-	return qs, true
+	return m
 }
 
-func (s *TestStore) CleanupExpired() {
-	if s.ttl == 0 {
-		return
+// toBank переводит индекс варианта, выбранный на фронте, в индекс банка
+func (a *Attempt) toBank(questionID, choice int) int {
+	order := a.OptionOrder[questionID]
+	if choice < 0 || choice >= len(order) {
+		return choice
 	}
-	now := time.Now()
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for id, exp := range s.expiresAt {
-		if now.After(exp) {
-			delete(s.testMap, id)
-			delete(s.expiresAt, id)
+	return order[choice]
+}
+
+// toShown переводит индекс варианта в банке в позицию, показанную на фронте
+func (a *Attempt) toShown(questionID, index int) int {
+	for i, j := range a.OptionOrder[questionID] {
+		if j == index {
+			return i
 		}
 	}
+	return index
 }
 
-// Пример — “база” вопросов в памяти
-var baseQuestions = []Question{
-	{
-		ID:       1,
-		Question: "Picture 4.2. Which port on the switch is used to connect computer/laptop with Ethernet cable?",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-		},
-		Answer: -1, // depends on Picture 4.2, not determinable without image
-	},
-	{
-		ID:       2,
-		Question: "Inside Laser Unit. Which element is responsible for reflecting laser string out of the Laser Unit to Imaging Drum?",
-		Options: []string{
-			"Spinning Mirror",
-			"Mirror",
-			"Lense #1",
-			"Lense #2",
-		},
-		Answer: 1, // Mirror
-	},
-	{
-		ID:       3,
-		Question: "Picture 1.1. Which of the following is the port of 'Receiving signals' for RJ45 on the main module of the cable tester?",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-		},
-		Answer: -1, // depends on Picture 1.1, not determinable without image
-	},
-	{
-		ID:       4,
-		Question: "Which hypervisor should be used while organizing hosted virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 1, // VMware Workstation is a hosted (Type 2) hypervisor
-	},
-	{
-		ID:       5,
-		Question: "Picture 5.3. Which of the following is the analog camera? (Two dome cameras shown, one with RJ-45, one with BNC connector.)",
-		Options: []string{
-			"Right",
-			"Left",
-		},
-		Answer: -1, // needs Picture 5.3 to know which side has the BNC (analog) connector
-	},
-	{
-		ID:       6,
-		Question: "Which tool can be used to perform crimping?",
-		Options: []string{
-			"Cable Tester",
-			"Crimping Tool",
-			"Pinout",
-			"Pliers (Plioskogubtsy)",
-		},
-		Answer: 1, // Crimping Tool
-	},
-	{
-		ID:       7,
-		Question: "Which hypervisor should be used while organizing native virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 0, // VMware ESXi is a native (Type 1) hypervisor
-	},
-	{
-		ID:       8,
-		Question: "Which term defines the right sequence of the twisted pair wires inside the connector?",
-		Options: []string{
-			"Colorcode",
-			"Pinout",
-			"Pin",
-			"Code",
-		},
-		Answer: 1, // Pinout
-	},
-	{
-		ID:       9,
-		Question: "Situation: You are using 32-bit Operating System. You need to install application or equipment which only supports 64-bit Operating System. What is one way to completely resolve the issue and be able to use those applications or equipment?",
-		Options: []string{
-			"Reinstall OS",
-			"Use Virtual Machine",
-			"Upgrade Operating System",
-			"Downgrade Operating System",
-		},
-		Answer: 2, // Upgrade Operating System (to a 64-bit edition)
-	},
-	{
-		ID:       10,
-		Question: "How can you check for connection with a switch management thru the serial connection?",
-		Options: []string{
-			"PING",
-			"ipconfig",
-			"impossible",
-			"ipconfig /all",
-		},
-		Answer: 2, // impossible (serial is not an IP connection you can ping)
-	},
-	{
-		ID:       11,
-		Question: "How can you check IP address assignment on your laptop (brief)?",
-		Options: []string{
-			"PING",
-			"ipconfig",
-			"impossible",
-			"ipconfig /all",
-		},
-		Answer: 1, // ipconfig
-	},
-	{
-		ID:       12,
-		Question: "Which power connector is retired connector for HDDs and Optical Drives?",
-		Options: []string{
-			"Molex",
-			"Berg",
-			"SATA Power",
-			"4Pin",
-		},
-		Answer: 0, // Molex
-	},
-	{
-		ID:       13,
-		Question: "What is the measurement for the speed of rotating motor in the HDD?",
-		Options: []string{
-			"RPM",
-			"RPS",
-			"KM/H",
-			"M/S",
-		},
-		Answer: 0, // RPM
-	},
-	{
-		ID:       14,
-		Question: "Picture 3.1. Which of the following elements are 'Spinning Mirror'? (Elements numbered 1–10 in the laser unit.)",
-		Options: []string{
-			"1 and 6",
-			"2 and 7",
-			"3 and 8",
-			"4 and 9",
-		},
-		Answer: -1, // depends on Picture 3.1, not determinable without image
-	},
-	{
-		ID:       15,
-		Question: "Which parameters you should know to establish Telnet connection with a switch?",
-		Options: []string{
-			"IP address, port number from device manager",
-			"Baud Rate, COM number from device manager",
-			"IP address, default port number by default",
-			"Speed, COM number by default",
-		},
-		Answer: 2, // IP address and default Telnet port (23)
-	},
-	{
-		ID:       16,
-		Question: "You configuring DHCP server. How should you assign IP for yourself?",
-		Options: []string{
-			"static IP",
-			"dynamic IP",
-		},
-		Answer: 0, // static IP
-	},
-	{
-		ID:       17,
-		Question: "What is the mixture of UTP + RJ45 on both ends?",
-		Options: []string{
-			"Ethernet cable",
-			"Connector",
-			"Wire",
-			"Tool",
-		},
-		Answer: 0, // Ethernet cable
-	},
-	{
-		ID:       18,
-		Question: "Situation: You need to print out a certificate. You use a specific paper for that, which is very expensive. Your paper tray is full of regular paper. What should you do?",
-		Options: []string{
-			"Unload paper tray, and load specific paper",
-			"Put specific paper on top of paper tray",
-			"Use manual feed tray",
-			"Use paper tray, instead of manual feed tray",
-		},
-		Answer: 2, // Use manual feed tray
-	},
-	{
-		ID:       19,
-		Question: "Picture 5.4. What is listed in the following window? (IP camera management software with a list of URLs.)",
-		Options: []string{
-			"IP cameras list",
-			"User accounts",
-			"FTP sessions",
-			"Virtual machines",
-		},
-		Answer: 0, // IP cameras list
-	},
-	{
-		ID:       20,
-		Question: "On the HDD picture, what is the measurement unit typically used for spindle motor speed specification?",
-		Options: []string{
-			"RPM",
-			"RPS",
-			"KM/H",
-			"M/S",
-		},
-		Answer: 0, // RPM
-	},
-	{
-		ID:       21,
-		Question: "Picture 3.1. Which of the following elements are 'Spinning Mirror'? (Elements numbered 1–10 in the laser unit.)",
-		Options: []string{
-			"1 and 6",
-			"2 and 7",
-			"3 and 8",
-			"4 and 9",
-		},
-		Answer: -1, // depends on Picture 3.1, not determinable without the specific diagram
-	},
-	{
-		ID:       22,
-		Question: "Picture 6.1. What is the IP address of management of ESXi hypervisor? (On screen: 'Download tools to manage this host from: http://192.168.205.120/ (VMCP)' and vSphere Client IP field.)",
-		Options: []string{
-			"DHCP",
-			"Not assigned",
-			"192.168.205.120",
-			"192.160.105",
-		},
-		Answer: 2, // 192.168.205.120
-	},
-	{
-		ID:       23,
-		Question: "Picture 1.1. Which of the following is the port of 'Receiving signals' for RJ45 on the main module of the cable tester? (Ports numbered 1–7 around the tester.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-			"5",
-			"6",
-			"7",
-		},
-		Answer: -1, // depends on Picture 1.1, not determinable without the specific tester layout
-	},
-	{
-		ID:       24,
-		Question: "Which hypervisor should be used while organizing bare metal virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 0, // VMware ESXi (Type 1 / bare metal hypervisor)
-	},
-	{
-		ID:       25,
-		Question: "What is the common name of virtualization software?",
-		Options: []string{
-			"Hypervisor",
-			"Hyper-V",
-			"VMware Workstation",
-			"Hyperterminal",
-		},
-		Answer: 0, // Hypervisor
-	},
-	{
-		ID:       26,
-		Question: "Picture 7.1. You are about to test virtual environment. You need fastest way to run any OS on VM. Which option would you choose? (VMware Workstation – selecting ISO image for installation.)",
-		Options: []string{
-			"Boot from physical DVD drive",
-			"Use ISO image file",
-			"Boot from network (PXE)",
-			"Use existing virtual disk",
-		},
-		Answer: 1, // Use ISO image file
-	},
-	{
-		ID:       27,
-		Question: "Inside Laser Unit. Which element is responsible for magnifying the laser string?",
-		Options: []string{
-			"Spinning Mirror",
-			"Mirror",
-			"Lense #1",
-			"Lense #2",
-		},
-		Answer: 2, // Lense #1 (lens does magnification)
-	},
-	{
-		ID:       28,
-		Question: "Inside Laser Unit. Which element is responsible for spreading laser beam into a string?",
-		Options: []string{
-			"Spinning Mirror",
-			"Mirror",
-			"Lense #1",
-			"Lense #2",
-		},
-		Answer: 0, // Spinning Mirror (polygon mirror scans beam into a line/string)
-	},
-	{
-		ID:       29,
-		Question: "Which is Crimper?",
-		Options: []string{
-			"Pliers (Plioskogubtsy)",
-			"Connector",
-			"Wire",
-			"Tool",
-		},
-		Answer: 3, // Tool
-	},
-	{
-		ID:       30,
-		Question: "Picture 4.1. Which Network Adapter is virtual and could be considered as the consequence of using virtualization? (Network Connections window, adapters numbered 1–6, several with 'VMware Network Adapter' in the name.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-			"5",
-			"6",
-		},
-		Answer: -1, // depends on which numbered item in Picture 4.1 is labeled 'VMware Network Adapter'
-	},
-	{
-		ID:       31,
-		Question: "Picture 5.3. Match the items with purpose: two dome cameras – left with RJ-45 and DC12V, right with BNC Connector and DC12V.",
-		Options: []string{
-			"Left – IP camera; Right – analog camera",
-			"Left – analog camera; Right – IP camera",
-			"Both – IP cameras",
-			"Both – analog cameras",
-		},
-		Answer: 0, // Left – IP camera (RJ-45); Right – analog camera (BNC)
-	},
-	{
-		ID:       32,
-		Question: "You configured DHCP server. How can you identify the host and understand which IP is assigned for it?",
-		Options: []string{
-			"by dynamic IP address",
-			"by MAC address",
-			"by PC model",
-			"by static IP address",
-		},
-		Answer: 1, // by MAC address
-	},
-	{
-		ID:       33,
-		Question: "Picture 8.6. Which option would you choose to boot to existing OS? (Boot Menu: 1. Removable Devices, 2. Hard Drive, 3. CD-ROM Drive, 4. Network boot.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-		},
-		Answer: 1, // Hard Drive
-	},
-	{
-		ID:       34,
-		Question: "Which output from cmd indicates successful answer from ping request?",
-		Options: []string{
-			"Reply from 192.168.1.1: bytes=32 time<1 ms TTL=255",
-			"Request timed out",
-			"Reply from 64.100.0.1: Destination host unreachable",
-			"Request successful",
-		},
-		Answer: 0, // successful ping has 'Reply from ... bytes=32 time=... TTL=...'
-	},
-	{
-		ID:       35,
-		Question: "Picture 4.1. Which Network Adapter is virtual and could be considered as the consequences of using virtualization? (Network Connections window with adapters numbered 1–6, VMware adapters among them.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-			"5",
-			"6",
-		},
-		Answer: -1, // depends on which numbers correspond to 'VMware Network Adapter' in the picture
-	},
-	{
-		ID:       36,
-		Question: "Situation: You need to access switch management. You just purchased new switch from store. What is the easiest way to find out the IP address?",
-		Options: []string{
-			"Read manual and find default IP address",
-			"Use console port to verify the IP address",
-			"Read manual to find the correct Baud Rate",
-			"Use network connection to access switch",
-		},
-		Answer: 0, // read manual for default management IP
-	},
-	{
-		ID:       37,
-		Question: "Picture 2.2. Options. Which board does not contain any malfunctions and can likely be used? (Photo of several PCBs, one without bulging/leaking capacitors.)",
-		Options: []string{
-			"Board A",
-			"Board B",
-			"Board C",
-			"Board D",
-		},
-		Answer: -1, // depends on the actual photo of the boards
-	},
-	{
-		ID:       38,
-		Question: "Picture 8.6. Which option would you choose to boot from ISO image? (Boot Menu: 1. Removable Devices, 2. Hard Drive, 3. CD-ROM Drive, 4. Network boot from AMD adapter.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-		},
-		Answer: 3, // CD-ROM Drive (typical for mounted ISO on many VMs)
-	},
-	{
-		ID:       39,
-		Question: "Picture 6.2. What is the password you are setting during FileZilla Server installation?",
-		Options: []string{
-			"password of FTP server",
-			"password of FTP server administration",
-			"password of Web server",
-			"password of Web server administration",
-		},
-		Answer: 1, // FTP server administration password
-	},
-	{
-		ID:       40,
-		Question: "Picture 1.1. Which of the following is the port of 'Transferring signals' for RJ11? (Cable tester views with ports numbered 1–7.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-			"5",
-			"6",
-			"7",
-		},
-		Answer: -1, // depends on the specific tester layout in the picture
-	},
-	{
-		ID:       41,
-		Question: "Which hypervisor should be used while organizing hosted virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 1, // VMware Workstation (hosted / Type 2 hypervisor)
-	},
-	{
-		ID:       42,
-		Question: "What are the main functions of IIS?",
-		Options: []string{
-			"FTP server, Web server",
-			"FTP server, FTP client",
-			"Web server, Web client",
-			"FTP client, Web client",
-		},
-		Answer: 0, // IIS provides Web and FTP server roles
-	},
-	{
-		ID:       43,
-		Question: "Which power connector is retired connector for HDDs and Optical Drives?",
-		Options: []string{
-			"Molex",
-			"Berg",
-			"SATA Power",
-			"4Pin",
-		},
-		Answer: 0, // Molex (legacy 4-pin peripheral power)
-	},
-	{
-		ID:       44,
-		Question: "Picture 5.2. Situation: You are sending ping request to switch in LAN. Your IP address: 192.168.255.15, switch IP address: 192.168.225.45. All your network cards are active. The CMD window shows 'Destination host unreachable' from another IP. What is the problem?",
-		Options: []string{
-			"Ping answer is successful",
-			"Ping sending packets thru wrong network card",
-			"Ping is sent to wrong IP",
-			"Your IP is in wrong subnet",
-		},
-		Answer: 1, // reply from another local IP with 'Destination host unreachable' ⇒ wrong NIC / route
-	},
-	{
-		ID:       45,
-		Question: "What is RJ45?",
-		Options: []string{
-			"Ethernet cable",
-			"Connector",
-			"Wire",
-			"Tool",
-		},
-		Answer: 1, // RJ45 is the connector
-	},
-	{
-		ID:       46,
-		Question: "Which PCB responsible for logical processing in the printer?",
-		Options: []string{
-			"Formatter (Green Board)",
-			"PS Board (Yellow Board)",
-			"Power Supply",
-			"Mother Board",
-		},
-		Answer: 0, // Formatter board handles printer logic / processing
-	},
-	{
-		ID:       47,
-		Question: "Picture 1.1. Which of the following is the port of 'Receiving signals' for RJ45 on the main module? (Cable tester with numbered ports 1–7.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-			"5",
-			"6",
-			"7",
-		},
-		Answer: -1, // depends on the specific tester diagram
-	},
-	{
-		ID:       48,
-		Question: "Picture 5.3. Match the items with its purpose. Two cameras: left with RG-45 and DC12V, right with BNC Connector and DC12V.",
-		Options: []string{
-			"DC12v – to power supply, RJ45 – to LAN, BNC – to analog recorder",
-			"BNC – to power supply, RJ45 – to LAN, DC12v – to analog recorder",
-			"DC12v – to power supply, BNC – to LAN, RJ45 – to analog recorder",
-			"RJ45 – to power supply, DC12v – to LAN, BNC – to analog recorder",
-		},
-		Answer: 0, // DC12V is power, RJ45 is LAN (IP cam), BNC is coax to analog recorder
-	},
-	{
-		ID:       49,
-		Question: "What are the main parameters when configuring FTP Server?",
-		Options: []string{
-			"Login credentials, assigned directory",
-			"Login, password",
-			"Assigned directory",
-			"Root directory",
-		},
-		Answer: 0, // need credentials + directory to share
-	},
-	{
-		ID:       50,
-		Question: "Which hypervisor should be used while organizing hosted virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 1, // VMware Workstation (hosted / Type 2)
-	},
-	{
-		ID:       51,
-		Question: "Picture 8.5. Which key will you use to enter BIOS? (Text on screen: 'Press F2 to enter SETUP, F12 for Network Boot, ESC for Boot Menu'.)",
-		Options: []string{
-			"F2",
-			"F12",
-			"ESC",
-			"Tab",
-		},
-		Answer: 0, // F2
-	},
-	{
-		ID:       52,
-		Question: "Which hypervisor should be used while organizing native virtualization?",
-		Options: []string{
-			"VMware ESXi",
-			"VMware Workstation",
-			"Windows 10",
-			"Windows XP",
-		},
-		Answer: 0, // VMware ESXi (native / Type 1)
-	},
-	{
-		ID:       53,
-		Question: "Which term defines the right sequence of the twisted pair wires inside the connector?",
-		Options: []string{
-			"Colorcode",
-			"Pinout",
-			"Pin",
-			"Code",
-		},
-		Answer: 1, // Pinout
-	},
-	{
-		ID:       54,
-		Question: "Situation: You are using 32-bit Operating System. You need to install application or equipment which only supports 64-bit Operating System. What is one way to completely resolve the issue and be able to use those applications?",
-		Options: []string{
-			"Reinstall OS",
-			"Use Virtual Machine",
-			"Upgrade Operating System",
-			"Downgrade Operating System",
-		},
-		Answer: 2, // Upgrade Operating System (to 64-bit)
-	},
-	{
-		ID:       55,
-		Question: "How can you check for connection with a switch management thru the serial connection?",
-		Options: []string{
-			"PING",
-			"ipconfig",
-			"impossible",
-			"ipconfig /all",
-		},
-		Answer: 2, // impossible (serial is not IP-based)
-	},
-	{
-		ID:       56,
-		Question: "What is the measurement for the speed of rotating motor in the HDD?",
-		Options: []string{
-			"RPM",
-			"RPS",
-			"KM/H",
-			"M/S",
-		},
-		Answer: 0, // RPM
-	},
-	{
-		ID:       57,
-		Question: "Picture 3.1. Which of the following elements are 'Spinning Mirror'? (Elements numbered 1–10 in the laser unit.)",
-		Options: []string{
-			"1 and 6",
-			"2 and 7",
-			"3 and 8",
-			"4 and 9",
-		},
-		Answer: -1, // depends on Picture 3.1, not visible here
-	},
-	{
-		ID:       58,
-		Question: "In FileZilla server user configuration window, which user has access to folder D:\\test? (User list shows 'system user', 'system user2', 'test', 'test2'.)",
-		Options: []string{
-			"system user",
-			"system user2",
-			"test",
-			"test2",
-		},
-		Answer: 2, // test (by typical naming in such task)
-	},
-	{
-		ID:       59,
-		Question: "How can you check IP address assignment on your laptop (brief)?",
-		Options: []string{
-			"PING",
-			"ipconfig",
-			"impossible",
-			"ipconfig /all",
-		},
-		Answer: 1, // ipconfig
-	},
-	{
-		ID:       60,
-		Question: "Which power connector is retired connector for HDDs and Optical Drives?",
-		Options: []string{
-			"Molex",
-			"Berg",
-			"SATA Power",
-			"4Pin",
-		},
-		Answer: 0, // Molex
-	},
-	{
-		ID:       61,
-		Question: "Picture 5.4. What is listed in the following window? (IP camera software showing 'Connect to IP Cameras' with URLs list.)",
-		Options: []string{
-			"List of IP cameras",
-			"List of FTP servers",
-			"List of virtual machines",
-			"List of users",
-		},
-		Answer: 0, // List of IP cameras
-	},
-	{
-		ID:       62,
-		Question: "Situation: You need to print out a certificate. You use a specific paper for that, which is very expensive. Your paper tray is full of regular paper. What should you do?",
-		Options: []string{
-			"Unload paper tray, and load specific paper",
-			"Put specific paper on top of paper tray",
-			"Use manual feed tray",
-			"Use paper tray, instead of manual feed tray",
-		},
-		Answer: 2, // Use manual feed tray
-	},
-	{
-		ID:       63,
-		Question: "Picture 3.1. Which of the following elements are 'Lense #2'?",
-		Options: []string{
-			"1 and 6",
-			"2 and 7",
-			"3 and 8",
-			"4 and 9",
-		},
-		Answer: -1, // depends on Picture 3.1, not visible here
-	},
-	{
-		ID:       64,
-		Question: "Picture 4.2. Which port on the switch is used to connect computer/laptop with Ethernet cable? (Ports group numbered 1–3.)",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-		},
-		Answer: -1, // depends on Picture 4.2 layout
-	},
-	{
-		ID:       65,
-		Question: "Picture 1.1. Which of the following is the port of 'Receiving signals' for RJ45 on the main module?",
-		Options: []string{
-			"1",
-			"2",
-			"3",
-			"4",
-		},
-		Answer: -1, // depends on that specific tester diagram
-	},
-	{
-		ID:       66,
-		Question: "What are the main parameters when configuring FTP Server?",
-		Options: []string{
-			"Login credentials, assigned directory",
-			"Login, password",
-			"Assigned directory",
-			"Root directory",
-		},
-		Answer: 0, // Login credentials, assigned directory
-	},
-	{
-		ID:       67,
-		Question: "Situation: You need to print out a certificate. You use a specific paper for that, which is very expensive. Your paper tray is full of regular paper. What should you do?",
-		Options: []string{
-			"Unload paper tray, and load specific paper",
-			"Put specific paper on top of paper tray",
-			"Use manual feed tray",
-			"Use paper tray, instead of manual feed tray",
-		},
-		Answer: 2, // Use manual feed tray
-	},
-	{
-		ID:       68,
-		Question: "How can you create LiveUSB?",
-		Options: []string{
-			"Write bootable image to USB Stick",
-			"Unarchive image and copy files to USB Stick",
-			"Copy image to USB Stick",
-		},
-		Answer: 0, // Write bootable image to USB Stick
-	},
-	{
-		ID:       69,
-		Question: "What are the main functions of IIS?",
-		Options: []string{
-			"FTP server, Web server",
-			"FTP server, FTP client",
-			"Web server, Web client",
-			"FTP client, Web client",
-		},
-		Answer: 0, // FTP server, Web server
-	},
-	{
-		ID:       70,
-		Question: "You configured DHCP server. How can you identify the host and understand which IP is assigned for it?",
-		Options: []string{
-			"by dynamic IP address",
-			"by MAC address",
-			"by PC model",
-			"by static IP address",
-		},
-		Answer: 1, // by MAC address
-	},
+// shownOptions — варианты вопроса в том порядке, в каком их видел студент
+func (a *Attempt) shownOptions(q Question) []string {
+	if order, ok := a.OptionOrder[q.ID]; ok {
+		return permuteStrings(q.Options, order)
+	}
+	return q.Options
 }
 
-var store = NewTestStore(30 * time.Minute)
+// Хранилище попыток; выбирается в main по флагу -store
+var store TestStore
+
+// Сколько живёт несданная попытка
+const attemptTTL = 30 * time.Minute
+
+// Сколько хранить результаты сданных попыток для /results
+var keepResults time.Duration
 
 func main() {
+	// fabulousProject validate [-bank dir] — проверка банка без запуска сервера
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout))
+	}
+
+	bankDir := flag.String("bank", "bank", "directory with question bank files (JSON/YAML)")
+	examsDir := flag.String("exams", "exams", "directory with exam blueprint files (JSON/YAML)")
+	adminToken := flag.String("admin-token", "", "bearer token for /admin endpoints (empty disables them)")
+	flag.DurationVar(&keepResults, "keep-results", 7*24*time.Hour, "how long submitted results stay available at /results")
+	storePath := flag.String("store", "", "append-only file for attempts, restored on restart (empty = in memory only)")
+	secret := flag.String("id-secret", "", "key for HMAC-signed test_id tokens (empty = unsigned random ids; changing it invalidates open attempts)")
+	flag.IntVar(&questionsPerTest, "questions", 0, "questions per attempt for exams without a blueprint (0 = whole bank)")
+	flag.Parse()
+
 	rand.Seed(time.Now().UnixNano())
+	if *secret != "" {
+		idSecret = []byte(*secret)
+	}
+
+	if _, err := reloadBank(*bankDir, *examsDir); err != nil {
+		log.Fatal(err)
+	}
+
+	if *storePath == "" {
+		store = NewMemoryStore(attemptTTL)
+	} else {
+		fs, err := OpenFileStore(*storePath, attemptTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fs.Close()
+		store = fs
+	}
+
+	// kill -HUP перечитывает банк без рестарта
+	watchSIGHUP(*bankDir, *examsDir)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/start", startHandler)
 	mux.HandleFunc("/submit", submitHandler)
+	mux.HandleFunc("/results/{test_id}", resultsHandler)
+	mux.HandleFunc("/remaining/{test_id}", remainingHandler)
+	mux.HandleFunc("/save", saveHandler)
+	mux.HandleFunc("/attempt/{test_id}", attemptHandler)
+	mux.HandleFunc("/media/{id}", mediaHandler)
+	mux.HandleFunc("/categories", categoriesHandler)
+	mux.HandleFunc("/exams", examsHandler)
+	if *adminToken != "" {
+		mux.HandleFunc("/admin/reload", adminReloadHandler(*bankDir, *examsDir, *adminToken))
+		mux.HandleFunc("/admin/attempts/{test_id}/void", adminVoidHandler(*adminToken))
+	}
 
 	// CORS для локального фронта
 	handler := withCORS(mux)
@@ -955,34 +447,136 @@ func startHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Здесь можно загрузить из файла вместо baseQuestions.
-	// Пример для файла:
-	//   f, err := os.Open("test.json")
-	//   ... json.NewDecoder(f).Decode(&baseQuestions)
+	user := strings.TrimSpace(req.User)
+	if user == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"error":   "user is required",
+		})
+		return
+	}
+
+	bank := currentBank.Load()
+
+	exam, err := findExam(bank, req.Exam)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if exam.Closed(time.Now()) {
+		writeJSON(w, http.StatusForbidden, map[string]any{
+			"success": false,
+			"error":   "exam is closed",
+		})
+		return
+	}
+
+	// В попытку попадает только выборка — по ней же потом считается Total.
+	// Порядок вопросов и вариантов у каждой попытки свой.
 	// [Важно: на фронт не возвращать Answer!]
+	selected, err := selectQuestions(bank, exam, req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	qs := shuffleQuestions(selected)
+	now := time.Now()
+	attempt := &Attempt{
+		Questions:   qs,
+		BankVersion: bank.Version,
+		Exam:        exam,
+		OptionOrder: make(map[int][]int, len(qs)),
+		Media:       snapshotMedia(bank, qs),
+		User:        user,
+		State:       AttemptStarted,
+		StartedAt:   now,
+		Deadline:    exam.deadline(now),
+	}
+	for _, q := range qs {
+		attempt.OptionOrder[q.ID] = shuffleOptions(q)
+	}
 
 	// Генерируем test_id (упростим)
 	testID := randomTestID()
 
-	// Сохраняем полный список (с Answer) в store
-	store.Put(testID, baseQuestions)
+	// Сохраняем полный список (с Answer) в store вместе с версией банка
+	if err := store.Put(testID, attempt); err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+
+	resp := StartResponse{
+		Success:   true,
+		TestID:    testID,
+		Questions: publicQuestions(attempt),
+		Deadline:  attempt.Deadline,
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	// Формируем публичные вопросы для фронта
-	pub := make([]PublicQuestion, len(baseQuestions))
-	for i, q := range baseQuestions {
+// publicQuestions — вопросы попытки для фронта, в порядке показа
+// и с перемешанными вариантами
+func publicQuestions(attempt *Attempt) []PublicQuestion {
+	pub := make([]PublicQuestion, len(attempt.Questions))
+	for i, q := range attempt.Questions {
 		pub[i] = PublicQuestion{
 			ID:       q.ID,
+			Type:     q.Kind(),
 			Question: q.Question,
-			Options:  q.Options,
+			Tags:     q.Tags,
+			Prompts:  q.Prompts,
+			Options:  attempt.shownOptions(q),
+			Media:    attempt.publicMedia(q.Media),
+			Image:    attempt.publicImage(q.Image),
 		}
 	}
+	return pub
+}
 
-	resp := StartResponse{
-		Success:   true,
-		TestID:    testID,
-		Questions: pub,
+// GET /categories — темы текущего банка и число вопросов в каждой
+func categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"categories": countTags(currentBank.Load().Questions),
+	})
+}
+
+// GET /exams — экзамены, которые можно запросить в /start
+func examsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
+	}
+	bank := currentBank.Load()
+	list := make([]map[string]any, 0, len(bank.Exams))
+	for _, id := range slices.Sorted(maps.Keys(bank.Exams)) {
+		list = append(list, map[string]any{
+			"id":        id,
+			"title":     bank.Exams[id].Title,
+			"questions": bank.Exams[id].Size(),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"exams":   list,
+	})
 }
 
 func submitHandler(w http.ResponseWriter, r *http.Request) {
@@ -1004,49 +598,256 @@ func submitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Достаем серверные правильные ответы по test_id
-	qs, ok := store.Get(req.TestID)
-	if !ok {
+	attempt, err := findAttempt(req.TestID)
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	if err := attempt.checkUser(req.User); err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+
+	// Повтор уже принятой сдачи (например, после обрыва связи) получает
+	// тот же результат; другие ответы на сданную попытку — ошибка
+	now := time.Now()
+	answers := req.Answers
+	if req.UseSaved {
+		answers = mergeAnswers(attempt.Saved, req.Answers)
+	}
+	// digest — от ответов в том виде, в каком их прислали, а не от тех, что
+	// пошли в проверку: иначе повтор опоздавшей сдачи не узнать
+	digest := answersDigest(answers)
+	autoGraded := false
+	err = attempt.checkOpen(now)
+	if errors.Is(err, errTimeLimit) && attempt.Exam.OnTimeout == TimeoutAutograde && len(attempt.Saved) > 0 {
+		// Опоздание: присланное не принимаем, проверяем то, что успело сохраниться.
+		// Если не сохранилось ничего, ставить 0 хуже, чем отказать, как при reject.
+		answers, autoGraded, err = attempt.Saved, true, nil
+	}
+	if attempt.State == AttemptSubmitted && attempt.Digest == digest {
+		writeJSON(w, http.StatusOK, disclose(attempt.Exam, attempt.Result, now))
+		return
+	}
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+
+	qs := attempt.Questions
+
+	// Вопросы без ключа откладываем отдельно
+	qByID := attempt.questionsByID()
+	total := 0.0
+	unscored := []int{}
+	categories := make(map[string]*CategoryScore)
+	for _, q := range qs {
+		if q.Unscored() {
+			unscored = append(unscored, q.ID)
+			continue
+		}
+		total += q.Weight()
+		for _, t := range q.Tags {
+			if categories[t] == nil {
+				categories[t] = &CategoryScore{}
+			}
+			categories[t].Total += q.Weight()
+		}
+	}
+
+	// Сначала проверяем запрос целиком и сообщаем обо всех ошибках сразу
+	if problems := validateAnswers(qByID, answers); len(problems) > 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"success":  false,
+			"error":    "invalid answers",
+			"problems": problems,
+		})
+		return
+	}
+
+	score := 0.0
+	review := make([]ReviewItem, 0, len(answers))
+	policy := attempt.Exam.ScoringPolicy()
+
+	for _, a := range answers {
+		q := qByID[a.QuestionID]
+		item := gradeAnswer(attempt, q, a)
+		item.Image = attempt.publicImage(q.Image)
+		item.MaxPoints = q.Weight()
+		if !item.Unscored {
+			item.Points = policy.Award(q, item)
+			score += item.Points
+			for _, t := range q.Tags {
+				categories[t].Score += item.Points
+			}
+		}
+		review = append(review, item)
+	}
+
+	resp := &SubmitResponse{
+		Success:  true,
+		User:     attempt.User,
+		Score:    score,
+		Total:    total,
+		Unscored: unscored,
+		Results:  review,
+
+		Categories: categories,
+		AutoGraded: autoGraded,
+	}
+	resp.Percent, resp.Grade, resp.Passed = attempt.Exam.Grade(score, total)
+	// Сохраняем полный результат, а отдаём — по политике разбора экзамена.
+	// Параллельная сдача той же попытки могла успеть раньше — тогда
+	// Finish вернёт её результат или ошибку.
+	recorded, err := store.Finish(req.TestID, digest, resp, keepResults)
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, disclose(attempt.Exam, recorded, now))
+}
+
+// GET /remaining/{test_id}?user=... — сколько времени осталось до дедлайна попытки.
+// Клиент сверяет с этим свой таймер: считать надо по часам сервера.
+func remainingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
 			"success": false,
-			"error":   "invalid or expired test_id",
+			"error":   "Method Not Allowed",
 		})
 		return
 	}
 
-	// Индексируем по id
-	qByID := make(map[int]Question, len(qs))
-	for _, q := range qs {
-		qByID[q.ID] = q
+	attempt, err := findAttempt(r.PathValue("test_id"))
+	if err == nil {
+		err = attempt.checkUser(r.URL.Query().Get("user"))
 	}
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	now := time.Now()
+	resp := map[string]any{
+		"success":     true,
+		"state":       attempt.State,
+		"server_time": now,
+	}
+	if attempt.Deadline != nil {
+		resp["deadline"] = attempt.Deadline
+		resp["grace_until"] = attempt.Deadline.Add(attempt.Exam.Grace.Duration)
+		resp["remaining_ms"] = max(0, attempt.Deadline.Sub(now).Milliseconds())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	score := 0
-	review := make([]ReviewItem, 0, len(req.Answers))
+// answersDigest — отпечаток набора ответов для распознавания повторной сдачи
+func answersDigest(answers []Answer) string {
+	data, _ := json.Marshal(answers)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
-	for _, a := range req.Answers {
-		q, exists := qByID[a.QuestionID]
-		if !exists {
-			// неизвестный id — пропускаем
-			continue
+// writeAttemptError отвечает на ошибку попытки подходящим статусом
+func writeAttemptError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errAttemptNotFound):
+		status = http.StatusBadRequest
+	case errors.Is(err, errForgedTestID):
+		status = http.StatusBadRequest
+		// Кто и что подбирает — в лог, клиенту — без подробностей
+		log.Printf("rejected forged test_id from %s: %v", r.RemoteAddr, err)
+		err = errForgedTestID
+	case errors.Is(err, errWrongUser):
+		status = http.StatusForbidden
+	case errors.Is(err, errAlreadySubmitted):
+		status = http.StatusConflict
+	case errors.Is(err, errAttemptVoided), errors.Is(err, errAttemptExpired), errors.Is(err, errTimeLimit):
+		status = http.StatusGone
+	default:
+		log.Printf("attempt store: %v", err)
+		err = errors.New("cannot save attempt")
+	}
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
+// POST /admin/attempts/{test_id}/void — аннулировать попытку
+func adminVoidHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+				"success": false,
+				"error":   "Method Not Allowed",
+			})
+			return
+		}
+		if !checkAdminToken(r, token) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"error":   "unauthorized",
+			})
+			return
+		}
+
+		testID := r.PathValue("test_id")
+		if err := checkTestID(testID); err != nil {
+			writeAttemptError(w, r, err)
+			return
 		}
-		if a.Choice == q.Answer {
-			score++
+		if err := store.Void(testID); err != nil {
+			writeAttemptError(w, r, err)
+			return
 		}
-		review = append(review, ReviewItem{
-			QuestionID:    q.ID,
-			Question:      q.Question,
-			Options:       q.Options,
-			CorrectChoice: q.Answer,
-			UserChoice:    a.Choice,
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"state":   AttemptVoided,
 		})
 	}
+}
 
-	resp := SubmitResponse{
-		Success: true,
-		Score:   score,
-		Total:   len(qs),
-		Results: review,
+// POST /admin/reload — перечитать банк вопросов.
+// Уже начатые попытки продолжают проверяться по своему снимку.
+func adminReloadHandler(bankDir, examsDir, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+				"success": false,
+				"error":   "Method Not Allowed",
+			})
+			return
+		}
+		if !checkAdminToken(r, token) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"error":   "unauthorized",
+			})
+			return
+		}
+
+		bank, err := reloadBank(bankDir, examsDir)
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"success": false,
+				"error":   err.Error(),
+				"version": currentBank.Load().Version,
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success":   true,
+			"version":   bank.Version,
+			"questions": len(bank.Questions),
+			"exams":     len(bank.Exams),
+		})
 	}
-	writeJSON(w, http.StatusOK, resp)
+}
+
+func checkAdminToken(r *http.Request, token string) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -1054,12 +855,3 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
-
-func randomTestID() string {
-	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, 10)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
-	}
-	return "test-" + string(b)
-}
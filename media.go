@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Вложение из файла банка: картинка, звук или видео.
+// Содержимое берётся из файла рядом с банком (File) или прямо из Data (base64).
+type MediaAsset struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`           // image | audio | video
+	File string `json:"file,omitempty"` // путь относительно каталога банка
+	Data string `json:"data,omitempty"` // содержимое в base64
+	Alt  string `json:"alt,omitempty"`  // текстовое описание, для image обязательно
+
+	content       []byte
+	contentType   string
+	hash          string // начало sha256 содержимого: версия в URL и ETag
+	width, height int    // размер картинки, если формат удалось разобрать
+}
+
+// Вложение в том виде, в каком его видит фронт
+type PublicMedia struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	Alt  string `json:"alt,omitempty"`
+}
+
+// id может переиспользоваться после правки файла, поэтому в URL вложения
+// стоит хэш содержимого (?v=). По такому URL содержимое не меняется и его
+// можно кэшировать навсегда; без версии или со старой версией браузер
+// перепроверяет вложение по ETag при каждом показе.
+const (
+	mediaCacheImmutable  = "public, max-age=31536000, immutable"
+	mediaCacheRevalidate = "no-cache"
+)
+
+// loadMediaAsset проверяет описание вложения и читает его содержимое.
+// dir — каталог банка, за его пределы File выходить не может.
+func loadMediaAsset(dir string, m *MediaAsset, h io.Writer) error {
+	if m.ID == "" || strings.ContainsAny(m.ID, "/\\") {
+		return fmt.Errorf("media id %q is invalid", m.ID)
+	}
+	switch m.Type {
+	case "image":
+		if strings.TrimSpace(m.Alt) == "" {
+			return fmt.Errorf("media %q: alt text required for images", m.ID)
+		}
+	case "audio", "video":
+	default:
+		return fmt.Errorf("media %q: unknown type %q", m.ID, m.Type)
+	}
+
+	switch {
+	case m.File != "" && m.Data != "":
+		return fmt.Errorf("media %q: set either file or data, not both", m.ID)
+	case m.File != "":
+		if !filepath.IsLocal(m.File) {
+			return fmt.Errorf("media %q: file %q must be inside the bank directory", m.ID, m.File)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, m.File))
+		if err != nil {
+			return fmt.Errorf("media %q: %w", m.ID, err)
+		}
+		m.content = b
+		m.contentType = mime.TypeByExtension(filepath.Ext(m.File))
+	case m.Data != "":
+		b, err := base64.StdEncoding.DecodeString(m.Data)
+		if err != nil {
+			return fmt.Errorf("media %q: invalid base64 data: %w", m.ID, err)
+		}
+		m.content = b
+	default:
+		return fmt.Errorf("media %q: file or data required", m.ID)
+	}
+
+	if m.contentType == "" {
+		m.contentType = http.DetectContentType(m.content)
+	}
+	if m.Type == "image" {
+		// SVG и прочие форматы без декодера — размер просто неизвестен
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(m.content)); err == nil {
+			m.width, m.height = cfg.Width, cfg.Height
+		}
+	}
+	sum := sha256.Sum256(m.content)
+	m.hash = hex.EncodeToString(sum[:8])
+	fmt.Fprintf(h, "%s\x00", m.ID)
+	h.Write(m.content)
+	return nil
+}
+
+// Все версии вложений, которые были в загруженных банках: id@hash -> вложение.
+// Попытка ссылается на версию, показанную при старте, и после перезагрузки
+// банка по её URL отдаётся то же содержимое. Правки вложений редки, поэтому
+// старые версии не удаляются; после рестарта сервера остаются только текущие.
+var mediaVersions sync.Map
+
+// archiveMedia запоминает версии вложений загруженного банка
+func archiveMedia(bank *Bank) {
+	for _, m := range bank.Media {
+		mediaVersions.Store(m.ID+"@"+m.hash, m)
+	}
+}
+
+// snapshotMedia — ссылки на вложения вопросов попытки в версии банка bank
+func snapshotMedia(bank *Bank, qs []Question) map[string]PublicMedia {
+	out := make(map[string]PublicMedia)
+	for _, q := range qs {
+		ids := q.Media
+		if q.Image != "" {
+			ids = append(slices.Clip(ids), q.Image)
+		}
+		for _, id := range ids {
+			if m, ok := bank.Media[id]; ok {
+				out[id] = PublicMedia{ID: m.ID, Type: m.Type, URL: m.url(), Alt: m.Alt}
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// url — адрес вложения с версией содержимого
+func (m *MediaAsset) url() string {
+	return "/media/" + m.ID + "?v=" + m.hash
+}
+
+// publicMedia собирает вложения вопроса для фронта из снимка попытки
+func (a *Attempt) publicMedia(ids []string) []PublicMedia {
+	if len(ids) == 0 {
+		return nil
+	}
+	out := make([]PublicMedia, 0, len(ids))
+	for _, id := range ids {
+		if pm, ok := a.Media[id]; ok {
+			out = append(out, pm)
+		}
+	}
+	return out
+}
+
+// publicImage — картинка вопроса hotspot для фронта (nil, если её нет)
+func (a *Attempt) publicImage(id string) *PublicMedia {
+	if pm, ok := a.Media[id]; ok && id != "" {
+		return &pm
+	}
+	return nil
+}
+
+// GET /media/{id}?v=... — содержимое вложения: версии v, если она известна,
+// иначе из текущего банка
+func mediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
+	}
+
+	id, v := r.PathValue("id"), r.URL.Query().Get("v")
+	var m *MediaAsset
+	if old, ok := mediaVersions.Load(id + "@" + v); ok {
+		m = old.(*MediaAsset)
+	} else {
+		m = currentBank.Load().Media[id]
+	}
+	if m == nil {
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"success": false,
+			"error":   "media not found",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", m.contentType)
+	if v == m.hash {
+		w.Header().Set("Cache-Control", mediaCacheImmutable)
+	} else {
+		w.Header().Set("Cache-Control", mediaCacheRevalidate)
+	}
+	w.Header().Set("ETag", `"`+m.hash+`"`)
+	// ServeContent сам отвечает 304 на If-None-Match и поддерживает Range
+	http.ServeContent(w, r, m.ID, time.Time{}, bytes.NewReader(m.content))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Политики разбора: что студент видит после сдачи
+const (
+	ReviewScore      = "score"       // только балл, без разбора по вопросам
+	ReviewWrong      = "wrong"       // какие вопросы неверны, но без ключа
+	ReviewFull       = "full"        // полный разбор с ключом и пояснениями (по умолчанию)
+	ReviewAfterClose = "after_close" // до закрытия экзамена — как wrong, после — full
+)
+
+// checkReviewPolicy проверяет политику разбора экзамена
+func (e *Exam) checkReviewPolicy() []string {
+	switch e.Review {
+	case "", ReviewScore, ReviewWrong, ReviewFull:
+	case ReviewAfterClose:
+		if e.ClosesAt == nil {
+			return []string{"review after_close requires closes_at"}
+		}
+	default:
+		return []string{fmt.Sprintf("unknown review policy %q", e.Review)}
+	}
+	return nil
+}
+
+// Closed — закончилось ли окно экзамена к моменту now
+func (e *Exam) Closed(now time.Time) bool {
+	return e.ClosesAt != nil && !now.Before(*e.ClosesAt)
+}
+
+// reviewPolicy — политика, действующая в момент now
+func (e *Exam) reviewPolicy(now time.Time) string {
+	switch e.Review {
+	case "":
+		return ReviewFull
+	case ReviewAfterClose:
+		if e.Closed(now) {
+			return ReviewFull
+		}
+		return ReviewWrong
+	}
+	return e.Review
+}
+
+// disclose готовит сохранённый результат к выдаче по политике экзамена.
+// Сохранённый результат не меняется — ключ откроется, когда позволит политика.
+func disclose(exam *Exam, res *SubmitResponse, now time.Time) SubmitResponse {
+	out := *res
+	out.Review = exam.reviewPolicy(now)
+	if exam.Review == ReviewAfterClose && out.Review != ReviewFull {
+		out.KeyAvailableAt = exam.ClosesAt
+	}
+
+	switch out.Review {
+	case ReviewScore:
+		out.Results = nil
+	case ReviewWrong:
+		out.Results = make([]ReviewItem, len(res.Results))
+		for i, item := range res.Results {
+			out.Results[i] = item.withoutKey()
+		}
+	}
+	return out
+}
+
+// withoutKey оставляет в пункте разбора ответ студента и балл,
+// но убирает всё, из чего можно восстановить правильный ответ
+func (item ReviewItem) withoutKey() ReviewItem {
+	item.CorrectChoice = -1
+	item.CorrectChoices = nil
+	item.OptionScores = nil
+	item.CorrectOrder = nil
+	item.Accepted = nil
+	item.CorrectValue = nil
+	item.Tolerance = 0
+	item.Regions = nil
+	item.Explanation = ""
+	if item.Pairs != nil {
+		pairs := make([]PairResult, len(item.Pairs))
+		for i, p := range item.Pairs {
+			p.CorrectTarget = -1
+			pairs[i] = p
+		}
+		item.Pairs = pairs
+	}
+	return item
+}
+
+// GET /results/{test_id}?user=... — результат сданной попытки по политике разбора
+// экзамена на текущий момент
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
+			"success": false,
+			"error":   "Method Not Allowed",
+		})
+		return
+	}
+
+	attempt, err := findAttempt(r.PathValue("test_id"))
+	if errors.Is(err, errAttemptNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]any{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err == nil {
+		err = attempt.checkUser(r.URL.Query().Get("user"))
+	}
+	if err != nil {
+		writeAttemptError(w, r, err)
+		return
+	}
+	if attempt.State == AttemptVoided {
+		writeAttemptError(w, r, errAttemptVoided)
+		return
+	}
+	// Время вышло без сдачи: результата не будет, сдавать уже поздно
+	if attempt.State == AttemptExpired {
+		writeAttemptError(w, r, errAttemptExpired)
+		return
+	}
+	if attempt.State != AttemptSubmitted {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"success": false,
+			"error":   "attempt is not submitted yet",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, disclose(attempt.Exam, attempt.Result, time.Now()))
+}
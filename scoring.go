@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ScoringPolicy переводит разобранный ответ в баллы за вопрос.
+// item.Credit — доля ключа, которую студент угадал (с OptionScores может
+// быть отрицательной), item.Skipped — ответа не было.
+type ScoringPolicy interface {
+	Award(q Question, item ReviewItem) float64
+}
+
+// Политики начисления баллов по имени из описания экзамена
+var scoringPolicies = map[string]func(e *Exam) ScoringPolicy{
+	"standard": func(*Exam) ScoringPolicy { return standardScoring{} },
+	"negative": func(e *Exam) ScoringPolicy { return negativeScoring{penalty: e.Penalty} },
+}
+
+// Политика, если экзамен не указал свою
+const defaultScoring = "standard"
+
+// ScoringPolicy — политика начисления баллов экзамена
+func (e *Exam) ScoringPolicy() ScoringPolicy {
+	name := e.Scoring
+	if name == "" {
+		name = defaultScoring
+	}
+	return scoringPolicies[name](e)
+}
+
+// checkScoring проверяет политику начисления баллов экзамена
+func (e *Exam) checkScoring() []string {
+	var problems []string
+	if _, ok := scoringPolicies[e.Scoring]; e.Scoring != "" && !ok {
+		problems = append(problems, fmt.Sprintf("unknown scoring policy %q", e.Scoring))
+	}
+	if e.Penalty < 0 || e.Penalty > 1 {
+		problems = append(problems, fmt.Sprintf("penalty %g out of range [0, 1]", e.Penalty))
+	}
+	return problems
+}
+
+// standardScoring: баллы вопроса, умноженные на долю зачёта; за ошибку не снимается,
+// даже если option_scores дали отрицательную долю — это дело политики negative
+type standardScoring struct{}
+
+func (standardScoring) Award(q Question, item ReviewItem) float64 {
+	return q.Weight() * max(item.Credit, 0)
+}
+
+// negativeScoring: за неверный ответ снимается штраф, пропуск бесплатный.
+// Штраф — Penalty вопроса или доля penalty от его баллов; отрицательная доля
+// из option_scores снимает баллы вместо штрафа.
+type negativeScoring struct {
+	penalty float64
+}
+
+func (p negativeScoring) Award(q Question, item ReviewItem) float64 {
+	if item.Skipped || item.Credit != 0 {
+		return q.Weight() * item.Credit
+	}
+	if q.Penalty > 0 {
+		return -q.Penalty
+	}
+	return -p.penalty * q.Weight()
+}
+
+// Weight — сколько баллов стоит вопрос (по умолчанию 1)
+func (q Question) Weight() float64 {
+	if q.Points > 0 {
+		return q.Points
+	}
+	return 1
+}
+
+// checkScores проверяет баллы вопроса, штраф и оценки вариантов
+func checkScores(q Question) []string {
+	var problems []string
+	if q.Points < 0 {
+		problems = append(problems, "points must not be negative")
+	}
+	if q.Penalty < 0 {
+		problems = append(problems, "penalty must not be negative")
+	}
+	if len(q.OptionScores) == 0 {
+		return problems
+	}
+	if k := q.Kind(); k != TypeSingle && k != TypeMultiple {
+		return append(problems, fmt.Sprintf("option_scores are not used by %s questions", k))
+	}
+	if len(q.OptionScores) != len(q.Options) {
+		problems = append(problems, fmt.Sprintf("option_scores: %d entries for %d options", len(q.OptionScores), len(q.Options)))
+	}
+	for i, s := range q.OptionScores {
+		if s < -1 || s > 1 {
+			problems = append(problems, fmt.Sprintf("option_scores: entry %d (%g) out of range [-1, 1]", i, s))
+		}
+	}
+	if slices.Max(q.OptionScores) <= 0 {
+		problems = append(problems, "option_scores: no option scores above zero")
+	}
+	return problems
+}
+
+// optionCredit — доля зачёта по OptionScores за выбранные варианты
+// (индексы банка); для multiple оценки складываются, но не выходят за [-1, 1]
+func optionCredit(q Question, picked []int) float64 {
+	credit := 0.0
+	for _, c := range picked {
+		if c >= 0 && c < len(q.OptionScores) {
+			credit += q.OptionScores[c]
+		}
+	}
+	return min(max(credit, -1), 1)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestScoringPolicies(t *testing.T) {
+	q := Question{Points: 2}
+	tests := []struct {
+		name     string
+		item     ReviewItem
+		standard float64
+		negative float64
+	}{
+		{"correct", ReviewItem{Credit: 1}, 2, 2},
+		{"half", ReviewItem{Credit: 0.5}, 1, 1},
+		{"wrong", ReviewItem{}, 0, -1},
+		{"skipped", ReviewItem{Skipped: true}, 0, 0},
+		{"negative option score", ReviewItem{Credit: -0.5}, 0, -1},
+	}
+	exam := &Exam{Scoring: "negative", Penalty: 0.5}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (standardScoring{}).Award(q, tt.item); got != tt.standard {
+				t.Errorf("standard: %v, want %v", got, tt.standard)
+			}
+			if got := exam.ScoringPolicy().Award(q, tt.item); got != tt.negative {
+				t.Errorf("negative: %v, want %v", got, tt.negative)
+			}
+		})
+	}
+}
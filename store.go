@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Хранилище попыток по test_id. MemoryStore — для разработки,
+// FileStore переживает перезапуск сервера.
+type TestStore interface {
+	Put(testID string, a *Attempt) error
+	// Get возвращает копию попытки с текущим состоянием
+	Get(testID string) (*Attempt, bool)
+	// Finish записывает результат и переводит попытку в submitted,
+	// продлевая её хранение до keep, чтобы результат можно было запросить
+	// позже. digest — отпечаток присланного запроса (не ответов, которые
+	// пошли в проверку), повтор с тем же digest возвращает уже записанный результат.
+	Finish(testID, digest string, res *SubmitResponse, keep time.Duration) (*SubmitResponse, error)
+	// Save дописывает ответы к сохранённым и переводит попытку в in_progress;
+	// возвращает, сколько вопросов теперь сохранено
+	Save(testID string, answers []Answer) (int, error)
+	// Void аннулирует попытку: сдать её или получить результат уже нельзя
+	Void(testID string) error
+	CleanupExpired()
+}
+
+// Почему попытку нельзя сдать
+var (
+	errAttemptNotFound  = errors.New("invalid or expired test_id")
+	errAlreadySubmitted = errors.New("attempt already submitted")
+	errAttemptVoided    = errors.New("attempt voided")
+	errAttemptExpired   = errors.New("attempt expired")
+	errTimeLimit        = errors.New("time limit exceeded")
+	errWrongUser        = errors.New("test_id belongs to another user")
+)
+
+// Хранилище попыток в памяти
+type MemoryStore struct {
+	mu        sync.RWMutex
+	testMap   map[string]*Attempt  // test_id -> попытка
+	expiresAt map[string]time.Time // test_id -> время истечения (необязательно)
+	ttl       time.Duration
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		testMap:   make(map[string]*Attempt),
+		expiresAt: make(map[string]time.Time),
+		ttl:       ttl,
+	}
+}
+
+// expiry — срок хранения через d от текущего момента (нулевой, если ttl не задан)
+func (s *MemoryStore) expiry(d time.Duration) time.Time {
+	if s.ttl == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(max(s.ttl, d))
+}
+
+// expiredLocked — вышел ли срок попытки
+func (s *MemoryStore) expiredLocked(testID string) bool {
+	exp, ok := s.expiresAt[testID]
+	return ok && time.Now().After(exp)
+}
+
+func (s *MemoryStore) put(testID string, a *Attempt, exp time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.testMap[testID] = a
+	if !exp.IsZero() {
+		s.expiresAt[testID] = exp
+	}
+}
+
+// checkFinishLocked решает, можно ли сдать попытку с этим digest запроса.
+// Для повтора уже принятой сдачи возвращает записанный результат — в том
+// числе если тогда проверялись сохранённые ответы вместо присланных.
+func (s *MemoryStore) checkFinishLocked(testID, digest string) (*SubmitResponse, error) {
+	a, ok := s.testMap[testID]
+	switch {
+	case !ok:
+		return nil, errAttemptNotFound
+	case a.State == AttemptSubmitted && a.Digest == digest:
+		return a.Result, nil
+	case a.State == AttemptSubmitted:
+		return nil, errAlreadySubmitted
+	case a.State == AttemptVoided:
+		return nil, errAttemptVoided
+	case s.expiredLocked(testID) && !a.Overdue(time.Now()):
+		return nil, errAttemptExpired
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) finishLocked(testID, digest string, res *SubmitResponse, exp time.Time) {
+	a, ok := s.testMap[testID]
+	if !ok {
+		return
+	}
+	a.State = AttemptSubmitted
+	a.Digest = digest
+	a.Result = res
+	if !exp.IsZero() {
+		s.expiresAt[testID] = exp
+	}
+}
+
+// checkSaveLocked — можно ли ещё сохранять ответы попытки
+func (s *MemoryStore) checkSaveLocked(testID string) (*Attempt, error) {
+	a, ok := s.testMap[testID]
+	if !ok {
+		return nil, errAttemptNotFound
+	}
+	if err := a.checkOpen(time.Now()); err != nil {
+		return nil, err
+	}
+	if s.expiredLocked(testID) {
+		return nil, errAttemptExpired
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) saveLocked(testID string, saved []Answer) {
+	if a, ok := s.testMap[testID]; ok {
+		a.Saved = saved
+		a.State = AttemptInProgress
+	}
+}
+
+func (s *MemoryStore) voidLocked(testID string) error {
+	a, ok := s.testMap[testID]
+	if !ok {
+		return errAttemptNotFound
+	}
+	a.State = AttemptVoided
+	return nil
+}
+
+func (s *MemoryStore) Put(testID string, a *Attempt) error {
+	s.put(testID, a, s.expiry(a.lifetime(s.ttl)))
+	return nil
+}
+
+func (s *MemoryStore) Get(testID string) (*Attempt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.testMap[testID]
+	if !ok {
+		return nil, false
+	}
+	cp := *a
+	if (s.expiredLocked(testID) || cp.Overdue(time.Now())) && !cp.Closed() {
+		cp.State = AttemptExpired
+	}
+	return &cp, true
+}
+
+func (s *MemoryStore) Finish(testID, digest string, res *SubmitResponse, keep time.Duration) (*SubmitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, err := s.checkFinishLocked(testID, digest); prev != nil || err != nil {
+		return prev, err
+	}
+	s.finishLocked(testID, digest, res, s.expiry(keep))
+	return res, nil
+}
+
+func (s *MemoryStore) Save(testID string, answers []Answer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, err := s.checkSaveLocked(testID)
+	if err != nil {
+		return 0, err
+	}
+	saved := mergeAnswers(a.Saved, answers)
+	s.saveLocked(testID, saved)
+	return len(saved), nil
+}
+
+func (s *MemoryStore) Void(testID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.voidLocked(testID)
+}
+
+func (s *MemoryStore) CleanupExpired() {
+	s.cleanup()
+}
+
+// cleanup удаляет протухшие попытки и возвращает, сколько удалено
+func (s *MemoryStore) cleanup() int {
+	if s.ttl == 0 {
+		return 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, exp := range s.expiresAt {
+		if now.After(exp) {
+			delete(s.testMap, id)
+			delete(s.expiresAt, id)
+			n++
+		}
+	}
+	return n
+}
+
+// snapshot — все живые попытки в виде записей журнала
+func (s *MemoryStore) snapshot() []storeRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]storeRecord, 0, len(s.testMap))
+	for id, a := range s.testMap {
+		out = append(out, storeRecord{Op: "put", TestID: id, Attempt: a, Expires: s.expiresAt[id]})
+	}
+	return out
+}
+
+// Запись журнала FileStore: одна строка JSON на операцию
+type storeRecord struct {
+	Op      string          `json:"op"` // put | save | finish | void
+	TestID  string          `json:"test_id"`
+	Attempt *Attempt        `json:"attempt,omitempty"`
+	Answers []Answer        `json:"answers,omitempty"` // save: все сохранённые ответы
+	Digest  string          `json:"digest,omitempty"`
+	Result  *SubmitResponse `json:"result,omitempty"`
+	Expires time.Time       `json:"expires"`
+}
+
+// FileStore держит попытки в памяти и дописывает каждое изменение в журнал.
+// При открытии журнал проигрывается (так после рестарта восстанавливаются
+// незавершённые попытки) и переписывается заново без протухших записей;
+// то же происходит, когда CleanupExpired что-то удаляет.
+type FileStore struct {
+	mem *MemoryStore
+
+	mu   sync.Mutex // порядок записей в журнале
+	path string
+	f    *os.File
+}
+
+func OpenFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	s := &FileStore{mem: NewMemoryStore(ttl), path: path}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	s.mem.cleanup()
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	log.Printf("Restored %d attempts from %s", len(s.mem.testMap), path)
+	return s, nil
+}
+
+// replay читает журнал в память. Испорченные строки (например, недописанная
+// последняя при аварийной остановке) пропускаются.
+func (s *FileStore) replay() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open attempt store: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		var rec storeRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			log.Printf("attempt store %s: line %d: %v (skipped)", s.path, line, err)
+			continue
+		}
+		switch rec.Op {
+		case "put":
+			if rec.Attempt != nil {
+				s.mem.put(rec.TestID, rec.Attempt, rec.Expires)
+			}
+		case "save":
+			s.mem.saveLocked(rec.TestID, rec.Answers)
+		case "finish":
+			s.mem.finishLocked(rec.TestID, rec.Digest, rec.Result, rec.Expires)
+		case "void":
+			s.mem.voidLocked(rec.TestID)
+		default:
+			log.Printf("attempt store %s: line %d: unknown op %q (skipped)", s.path, line, rec.Op)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read attempt store: %w", err)
+	}
+	return nil
+}
+
+// compact переписывает журнал из памяти через временный файл и rename
+func (s *FileStore) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("compact attempt store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range s.mem.snapshot() {
+		if err := enc.Encode(rec); err != nil {
+			tmp.Close()
+			return fmt.Errorf("compact attempt store: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact attempt store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact attempt store: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("compact attempt store: %w", err)
+	}
+
+	if s.f != nil {
+		s.f.Close()
+	}
+	s.f, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open attempt store: %w", err)
+	}
+	return nil
+}
+
+// write дописывает запись в журнал, сбрасывает её на диск и только потом
+// применяет apply к памяти. Всё под одной блокировкой, чтобы compact не
+// потерял запись, попавшую в старый файл.
+func (s *FileStore) write(rec storeRecord, apply func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(rec, apply)
+}
+
+func (s *FileStore) writeLocked(rec storeRecord, apply func()) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write attempt store: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("write attempt store: %w", err)
+	}
+	apply()
+	return nil
+}
+
+func (s *FileStore) Put(testID string, a *Attempt) error {
+	exp := s.mem.expiry(a.lifetime(s.mem.ttl))
+	return s.write(storeRecord{Op: "put", TestID: testID, Attempt: a, Expires: exp}, func() {
+		s.mem.put(testID, a, exp)
+	})
+}
+
+func (s *FileStore) Get(testID string) (*Attempt, bool) {
+	return s.mem.Get(testID)
+}
+
+// Save, Finish и Void проверяют попытку и пишут журнал под s.mu, поэтому
+// между проверкой и записью состояние попытки измениться не может
+func (s *FileStore) Finish(testID, digest string, res *SubmitResponse, keep time.Duration) (*SubmitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.mu.RLock()
+	prev, err := s.mem.checkFinishLocked(testID, digest)
+	s.mem.mu.RUnlock()
+	if prev != nil || err != nil {
+		return prev, err
+	}
+
+	exp := s.mem.expiry(keep)
+	err = s.writeLocked(storeRecord{Op: "finish", TestID: testID, Digest: digest, Result: res, Expires: exp}, func() {
+		s.mem.mu.Lock()
+		defer s.mem.mu.Unlock()
+		s.mem.finishLocked(testID, digest, res, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *FileStore) Save(testID string, answers []Answer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.mu.RLock()
+	a, err := s.mem.checkSaveLocked(testID)
+	var saved []Answer
+	if err == nil {
+		saved = mergeAnswers(a.Saved, answers)
+	}
+	s.mem.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.writeLocked(storeRecord{Op: "save", TestID: testID, Answers: saved}, func() {
+		s.mem.mu.Lock()
+		defer s.mem.mu.Unlock()
+		s.mem.saveLocked(testID, saved)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(saved), nil
+}
+
+func (s *FileStore) Void(testID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.mem.Get(testID); !ok {
+		return errAttemptNotFound
+	}
+	return s.writeLocked(storeRecord{Op: "void", TestID: testID}, func() {
+		s.mem.Void(testID)
+	})
+}
+
+func (s *FileStore) CleanupExpired() {
+	if s.mem.cleanup() == 0 {
+		return
+	}
+	if err := s.compact(); err != nil {
+		log.Printf("attempt store cleanup: %v", err)
+	}
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
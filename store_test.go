@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	s, err := OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// journalLines читает журнал и проверяет, что каждая строка — целая запись
+func journalLines(t *testing.T, path string) []storeRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []storeRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec storeRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("journal line %q: %v", sc.Text(), err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attempts.jsonl")
+	s := openTestStore(t, path)
+	for _, id := range []string{"started", "saved", "submitted", "voided"} {
+		if err := s.Put(id, &Attempt{User: "ann", State: AttemptStarted, StartedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Save("saved", []Answer{{QuestionID: 1, Choice: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Finish("submitted", "d1", &SubmitResponse{Success: true, Score: 3, Total: 4}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Void("voided"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	tests := []struct {
+		id    string
+		state string
+	}{
+		{"started", AttemptStarted},
+		{"saved", AttemptInProgress},
+		{"submitted", AttemptSubmitted},
+		{"voided", AttemptVoided},
+	}
+	check := func(t *testing.T, s *FileStore) {
+		for _, tt := range tests {
+			a, ok := s.Get(tt.id)
+			if !ok {
+				t.Errorf("%s: not restored", tt.id)
+				continue
+			}
+			if a.State != tt.state || a.User != "ann" {
+				t.Errorf("%s: state %q user %q, want %q ann", tt.id, a.State, a.User, tt.state)
+			}
+		}
+		if a, _ := s.Get("saved"); len(a.Saved) != 1 || a.Saved[0].Choice != 2 {
+			t.Errorf("saved answers not restored: %+v", a.Saved)
+		}
+		if a, _ := s.Get("submitted"); a.Digest != "d1" || a.Result == nil || a.Result.Score != 3 {
+			t.Errorf("result not restored: digest %q result %+v", a.Digest, a.Result)
+		}
+		// Повтор той же сдачи после рестарта получает записанный результат
+		if res, err := s.Finish("submitted", "d1", &SubmitResponse{Score: 0}, time.Hour); err != nil || res.Score != 3 {
+			t.Errorf("repeated Finish = %+v, %v; want recorded result", res, err)
+		}
+		if _, err := s.Finish("submitted", "other", &SubmitResponse{}, time.Hour); err != errAlreadySubmitted {
+			t.Errorf("Finish with another digest: %v, want %v", err, errAlreadySubmitted)
+		}
+	}
+
+	s = openTestStore(t, path)
+	check(t, s)
+	s.Close()
+
+	// Открытие сжимает журнал до одной записи put на попытку
+	if recs := journalLines(t, path); len(recs) != len(tests) {
+		t.Errorf("compacted journal has %d records, want %d", len(recs), len(tests))
+	}
+	s = openTestStore(t, path)
+	check(t, s)
+	s.Close()
+}
+
+func TestFileStoreTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attempts.jsonl")
+	s := openTestStore(t, path)
+	if err := s.Put("a", &Attempt{User: "ann", State: AttemptStarted}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save("a", []Answer{{QuestionID: 1, Choice: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Аварийная остановка посреди записи: последняя строка недописана
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"save","test_id":"a","answers":[{"question_id":1,"cho`)
+	f.Close()
+
+	s = openTestStore(t, path)
+	a, ok := s.Get("a")
+	if !ok || a.State != AttemptInProgress || len(a.Saved) != 1 || a.Saved[0].Choice != 1 {
+		t.Fatalf("after truncated line: %+v, %v; want last complete save", a, ok)
+	}
+	// Следующая запись не должна склеиться с обрывком
+	if _, err := s.Save("a", []Answer{{QuestionID: 2, Choice: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	journalLines(t, path)
+	s = openTestStore(t, path)
+	defer s.Close()
+	if a, _ := s.Get("a"); len(a.Saved) != 2 {
+		t.Errorf("saved answers after reopen: %+v, want 2", a.Saved)
+	}
+}
+
+func TestFileStoreDropsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attempts.jsonl")
+	s := openTestStore(t, path)
+	s.Put("live", &Attempt{State: AttemptStarted})
+	s.Close()
+
+	// Запись с истёкшим сроком, как будто сервер стоял дольше ttl
+	data, _ := json.Marshal(storeRecord{Op: "put", TestID: "old", Attempt: &Attempt{State: AttemptStarted},
+		Expires: time.Now().Add(-time.Minute)})
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.Write(append(data, '\n'))
+	f.Close()
+
+	s = openTestStore(t, path)
+	defer s.Close()
+	if _, ok := s.Get("old"); ok {
+		t.Error("expired attempt restored")
+	}
+	if _, ok := s.Get("live"); !ok {
+		t.Error("live attempt lost")
+	}
+	if recs := journalLines(t, path); len(recs) != 1 || recs[0].TestID != "live" {
+		t.Errorf("compacted journal: %+v, want only live", recs)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Ссылка на иллюстрацию в тексте вопроса: "Picture 4.2"
+var pictureRef = regexp.MustCompile(`(?i)\bpicture\s+\d+(?:\.\d+)?`)
+
+// Вопросы считаются почти одинаковыми, если доля общих слов (Жаккар)
+// не меньше nearDuplicateThreshold или если один текст целиком входит
+// в другой (тот же вопрос с уточнением в скобках) и в нём не меньше
+// nearDuplicateMinWords слов
+const (
+	nearDuplicateThreshold = 0.85
+	nearDuplicateMinWords  = 6
+)
+
+// runValidate — подкоманда `validate`: проверяет банк и печатает отчёт.
+// Код возврата 0 — замечаний нет, 1 — есть замечания, 2 — банк не прочитать.
+func runValidate(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	bankDir := fs.String("bank", "bank", "directory with question bank files (JSON/YAML)")
+	examsDir := fs.String("exams", "exams", "directory with exam blueprint files (JSON/YAML)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		*bankDir = fs.Arg(0)
+	}
+
+	bank, berr, err := readBankDir(*bankDir)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+
+	problems := append([]string{}, berr.Problems...)
+	problems = append(problems, lintBank(bank)...)
+
+	// Экзамены проверяем, только если банк сам по себе корректен:
+	// иначе число вариантов ничего не значит
+	if len(berr.Problems) == 0 {
+		exams, err := LoadExams(*examsDir, bank)
+		var eerr *BankError
+		switch {
+		case errors.As(err, &eerr):
+			problems = append(problems, eerr.Problems...)
+		case err != nil:
+			problems = append(problems, err.Error())
+		}
+		for _, id := range slices.Sorted(maps.Keys(exams)) {
+			if exams[id].Blueprint != nil {
+				fmt.Fprintf(out, "exam %q: %d questions, %s distinct forms\n",
+					id, exams[id].Size(), exams[id].Forms())
+			}
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%d problems in %d questions from %d files\n",
+			len(problems), len(bank.Questions), len(bank.Files))
+		return 1
+	}
+	fmt.Fprintf(out, "ok: %d questions from %d files\n", len(bank.Questions), len(bank.Files))
+	return 0
+}
+
+// lintBank — содержательные проверки, которые не мешают запуску сервера,
+// но должны быть исправлены в контенте
+func lintBank(bank *Bank) []string {
+	var problems []string
+	report := func(i int, format string, args ...any) {
+		q := bank.Questions[i]
+		problems = append(problems, fmt.Sprintf("%s: id %d: %s", bank.sources[i], q.ID, fmt.Sprintf(format, args...)))
+	}
+
+	words := make([]map[string]bool, len(bank.Questions))
+	for i, q := range bank.Questions {
+		if q.Unscored() {
+			report(i, "unresolved answer key")
+		}
+		if ref := pictureRef.FindString(q.Question); ref != "" && !q.HasMedia() {
+			report(i, "refers to %q but has no media", ref)
+		}
+
+		seen := make(map[string]int, len(q.Options))
+		for j, opt := range q.Options {
+			norm := normalizeText(opt)
+			if norm == "" {
+				report(i, "option %d is empty", j)
+				continue
+			}
+			if prev, dup := seen[norm]; dup {
+				report(i, "option %d repeats option %d", j, prev)
+				continue
+			}
+			seen[norm] = j
+		}
+
+		words[i] = wordSet(q.Question)
+		for k := 0; k < i; k++ {
+			sim, contained := similarity(words[i], words[k])
+			if normalizeText(q.Question) == normalizeText(bank.Questions[k].Question) {
+				report(i, "duplicate of id %d", bank.Questions[k].ID)
+				break
+			}
+			if sim >= nearDuplicateThreshold || contained {
+				report(i, "near-duplicate of id %d (%.0f%% similar)", bank.Questions[k].ID, sim*100)
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// normalizeText приводит строку к нижнему регистру, а пунктуацию
+// и повторные пробелы схлопывает в один пробел
+func normalizeText(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(normalizeText(s)) {
+		set[w] = true
+	}
+	return set
+}
+
+// similarity возвращает коэффициент Жаккара для двух наборов слов и признак
+// того, что более короткий набор (не меньше nearDuplicateMinWords слов)
+// целиком входит в длинный
+func similarity(a, b map[string]bool) (float64, bool) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, false
+	}
+	inter := 0
+	for w := range a {
+		if b[w] {
+			inter++
+		}
+	}
+	shorter := min(len(a), len(b))
+	return float64(inter) / float64(len(a)+len(b)-inter),
+		inter == shorter && shorter >= nearDuplicateMinWords
+}